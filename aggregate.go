@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// AverageStatistic selects the per sample statistic of the iterations stored as the averaged series values.
+type AverageStatistic string
+
+const (
+	MeanStatistic   AverageStatistic = "mean"
+	MedianStatistic AverageStatistic = "median"
+)
+
+var averageStatistic = MeanStatistic
+
+func (s AverageStatistic) Validate() error {
+	if s != MeanStatistic && s != MedianStatistic {
+		return fmt.Errorf("unknown statistic %q, expected %q or %q", s, MeanStatistic, MedianStatistic)
+	}
+	return nil
+}
+
+// SeriesBands are the per sample spread of an averaged series over its iterations, in the series unit.
+type SeriesBands struct {
+	Iterations int
+	Mean       []float64
+	Median     []float64
+	P10        []float64
+	P90        []float64
+}
+
+// alignedSeries shifts the iterations so their tests start at the same sample, keeping the idle samples
+// every iteration recorded before it. Samples are aligned to a whole interval, the average start is returned.
+func alignedSeries(series []SeriesData) ([][]float64, time.Duration) {
+	if len(series) == 0 {
+		return nil, 0
+	}
+	interval := series[0].SampleInterval()
+	startIndexes := lo.Map(series, func(s SeriesData, _ int) int { return int(s.TestStart / interval) })
+	lead := lo.Min(startIndexes)
+
+	var remainders time.Duration
+	aligned := make([][]float64, len(series))
+	for i, s := range series {
+		aligned[i] = s.Values[min(startIndexes[i]-lead, len(s.Values)):]
+		remainders += s.TestStart % interval
+	}
+	return aligned, time.Duration(lead)*interval + remainders/time.Duration(len(series))
+}
+
+// aggregateSeries computes the statistics of every sample over the iterations that recorded it,
+// so a shorter iteration does not cut the others.
+func aggregateSeries(iterations [][]float64) *SeriesBands {
+	length := len(lo.MaxBy(iterations, func(a, b []float64) bool { return len(a) > len(b) }))
+	bands := &SeriesBands{
+		Iterations: len(iterations),
+		Mean:       make([]float64, length),
+		Median:     make([]float64, length),
+		P10:        make([]float64, length),
+		P90:        make([]float64, length),
+	}
+
+	for i := 0; i < length; i++ {
+		samples := make([]float64, 0, len(iterations))
+		for _, values := range iterations {
+			if i < len(values) {
+				samples = append(samples, values[i])
+			}
+		}
+		slices.Sort(samples)
+
+		bands.Mean[i] = lo.Sum(samples) / float64(len(samples))
+		bands.Median[i] = sortedQuantile(samples, 0.5)
+		bands.P10[i] = sortedQuantile(samples, 0.1)
+		bands.P90[i] = sortedQuantile(samples, 0.9)
+	}
+	return bands
+}
+
+// sortedQuantile linearly interpolates the q quantile of the sorted samples.
+func sortedQuantile(samples []float64, q float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	rank := q * float64(len(samples)-1)
+	low := int(math.Floor(rank))
+	high := min(low+1, len(samples)-1)
+	return samples[low] + (samples[high]-samples[low])*(rank-float64(low))
+}
+
+func (b *SeriesBands) Values(statistic AverageStatistic) []float64 {
+	if statistic == MedianStatistic {
+		return b.Median
+	}
+	return b.Mean
+}
@@ -6,6 +6,9 @@ import (
 	"math"
 	"strings"
 	"time"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/samber/lo"
 )
 
 type BenchmarkTest func(ReaderFactory)
@@ -16,138 +19,234 @@ type AllBenchmarkData map[BenchmarkType]BenchmarkData
 type BenchmarkType string
 
 var (
-	BenchmarkRateLimitingSynthetic       BenchmarkType = "BenchmarkRateLimitingSynthetic"
-	BenchmarkRateLimitingRealWorldLocal  BenchmarkType = "BenchmarkRateLimitingRealWorldLocal"
-	BenchmarkMaxReadOverTimeSynthetic    BenchmarkType = "BenchmarkMaxReadOverTimeSynthetic"
-	BenchmarkSpikeRecoveryRealWorldLocal BenchmarkType = "BenchmarkSpikeRecoveryRealWorldLocal"
+	BenchmarkRateLimitingSynthetic           BenchmarkType = "BenchmarkRateLimitingSynthetic"
+	BenchmarkRateLimitingRealWorldLocal      BenchmarkType = "BenchmarkRateLimitingRealWorldLocal"
+	BenchmarkMaxReadOverTimeSynthetic        BenchmarkType = "BenchmarkMaxReadOverTimeSynthetic"
+	BenchmarkSpikeRecoveryRealWorldLocal     BenchmarkType = "BenchmarkSpikeRecoveryRealWorldLocal"
+	BenchmarkRateLimitingRealWorldWrite      BenchmarkType = "BenchmarkRateLimitingRealWorldWrite"
+	BenchmarkCancellation                    BenchmarkType = "BenchmarkCancellation"
+	BenchmarkSharedLimitRealWorldLocal       BenchmarkType = "BenchmarkSharedLimitRealWorldLocal"
+	BenchmarkHierarchicalLimitRealWorldLocal BenchmarkType = "BenchmarkHierarchicalLimitRealWorldLocal"
 )
 
 type SeriesData struct {
-	Title  string
-	Values []int
-	Color  string
+	Title     string
+	Values    []float64
+	Unit      Unit `json:",omitempty"` // unit of Values, converted to the monitor display unit when graphed
+	Color     string
+	Interval  time.Duration `json:",omitempty"` // sampling interval of Values, zero in data saved before it was recorded
+	TestStart time.Duration `json:",omitempty"` // test start offset from the first sample start, used to align iterations
+
+	Percentiles *Percentiles      `json:",omitempty"` // whole test summary of histogram series, e.g. ReadLatency
+	Summary     *BenchmarkSummary `json:",omitempty"` // whole test summary of the ReadRX or WriteTX series
+	Bands       *SeriesBands      `json:",omitempty"` // per sample spread of averaged series
+
+	Cancellation *CancellationSummary `json:",omitempty"` // cancellation benchmark series only
+	Fairness     *FairnessSummary     `json:",omitempty"` // shared limit benchmark summary series only
+	Hierarchy    *HierarchySummary    `json:",omitempty"` // hierarchical limit benchmark summary series only
 }
 
-func RunBenchmark() AllBenchmarkData {
-	return AllBenchmarkData{
-		BenchmarkRateLimitingSynthetic:       RunBenchmarkRateLimitingSynthetic(),
-		BenchmarkRateLimitingRealWorldLocal:  RunBenchmarkRateLimitingRealWorldLocal(),
-		BenchmarkMaxReadOverTimeSynthetic:    RunBenchmarkMaxReadOverTimeSynthetic(),
-		BenchmarkSpikeRecoveryRealWorldLocal: RunBenchmarkSpikeRecoveryRealWorldLocal(),
+func (s SeriesData) SampleInterval() time.Duration {
+	if s.Interval == 0 {
+		return defaultMonitorInterval
 	}
+	return s.Interval
 }
 
-func RunBenchmarkRateLimitingSynthetic() BenchmarkData {
-	golangSeries := RunGolangTest(RateLimitingSyntheticTest, []MonitorValueType{SyntheticRX})
-	jujuSeries := RunJujuTest(RateLimitingSyntheticTest, []MonitorValueType{SyntheticRX})
-	uberSeries := RunUberTest(RateLimitingSyntheticTest, []MonitorValueType{SyntheticRX})
-	imadmonSeries := RunIMadmonTest(RateLimitingSyntheticTest, []MonitorValueType{SyntheticRX})
-	return BenchmarkData{
-		GolangReader: {
-			SyntheticRX: golangSeries[SyntheticRX],
-		},
-		JujuReader: {
-			SyntheticRX: jujuSeries[SyntheticRX],
-		},
-		UberReader: {
-			SyntheticRX: uberSeries[SyntheticRX],
-		},
-		IMadmonReader: {
-			SyntheticRX: imadmonSeries[SyntheticRX],
-		},
-	}
+type BenchmarkDefinition struct {
+	Type       BenchmarkType
+	Parameters BenchmarkParameters
+	Run        func(readers []RegisteredReader) BenchmarkData
+	Graph      func(data BenchmarkData) []*charts.Line
 }
 
-func RunBenchmarkRateLimitingRealWorldLocal() BenchmarkData {
-	golangSeries := RunGolangTest(RateLimitingRealWorldLocalTest, []MonitorValueType{RX, CPU, RAM})
-	jujuSeries := RunJujuTest(RateLimitingRealWorldLocalTest, []MonitorValueType{RX, CPU, RAM})
-	uberSeries := RunUberTest(RateLimitingRealWorldLocalTest, []MonitorValueType{RX, CPU, RAM})
-	imadmonSeries := RunIMadmonTest(RateLimitingRealWorldLocalTest, []MonitorValueType{RX, CPU, RAM})
-	return BenchmarkData{
-		GolangReader: {
-			RX:  golangSeries[RX],
-			CPU: golangSeries[CPU],
-			RAM: golangSeries[RAM],
-		},
-		JujuReader: {
-			RX:  jujuSeries[RX],
-			CPU: jujuSeries[CPU],
-			RAM: jujuSeries[RAM],
-		},
-		UberReader: {
-			RX:  uberSeries[RX],
-			CPU: uberSeries[CPU],
-			RAM: uberSeries[RAM],
-		},
-		IMadmonReader: {
-			RX:  imadmonSeries[RX],
-			CPU: imadmonSeries[CPU],
-			RAM: imadmonSeries[RAM],
-		},
-	}
+// BenchmarkParameters describe the data a test reads, the results are compared against them.
+type BenchmarkParameters struct {
+	DataSize   ByteSize     `json:"dataSize,omitempty"` // 0 means endless
+	BufferSize ByteSize     `json:"bufferSize"`
+	Limit      ByteSize     `json:"limit,omitempty"`    // bytes per second, 0 means unlimited
+	Duration   Duration     `json:"duration,omitempty"` // stop reading after duration, 0 means until EOF
+	Traffic    TrafficShape `json:"traffic,omitempty"`
+	LimitSteps []LimitStep  `json:"limitSteps,omitempty"`
 }
 
-func RunBenchmarkMaxReadOverTimeSynthetic() BenchmarkData {
-	golangSeries := RunGolangTest(MaxReadOverTimeSyntheticTest, []MonitorValueType{TotalSyntheticRX, CPU})
-	jujuSeries := RunJujuTest(MaxReadOverTimeSyntheticTest, []MonitorValueType{TotalSyntheticRX, CPU})
-	uberSeries := RunUberTest(MaxReadOverTimeSyntheticTest, []MonitorValueType{TotalSyntheticRX, CPU})
-	imadmonSeries := RunIMadmonTest(MaxReadOverTimeSyntheticTest, []MonitorValueType{TotalSyntheticRX, CPU})
-	return BenchmarkData{
-		GolangReader: {
-			TotalSyntheticRX: golangSeries[TotalSyntheticRX],
-			CPU:              golangSeries[CPU],
-		},
-		JujuReader: {
-			TotalSyntheticRX: jujuSeries[TotalSyntheticRX],
-			CPU:              jujuSeries[CPU],
-		},
-		UberReader: {
-			TotalSyntheticRX: uberSeries[TotalSyntheticRX],
-			CPU:              uberSeries[CPU],
-		},
-		IMadmonReader: {
-			TotalSyntheticRX: imadmonSeries[TotalSyntheticRX],
-			CPU:              imadmonSeries[CPU],
+var (
+	RateLimitingParameters = BenchmarkParameters{
+		DataSize:   100 * 1024 * 1024,     // 100MB
+		BufferSize: 32 * 1024,             // 32KB classic io.Copy
+		Limit:      100 * 1024 * 1024 / 4, // should take 4 seconds
+	}
+	MaxReadOverTimeParameters = BenchmarkParameters{
+		BufferSize: 32 * 1024, // 32KB classic io.Copy
+		Duration:   Duration(10 * time.Second),
+	}
+	SpikeRecoveryParameters = BenchmarkParameters{
+		DataSize:   100 * 1024 * 1024, // 100MB
+		BufferSize: 32 * 1024,         // 32KB classic io.Copy
+		Limit:      32 * 1024 * 500,   // should take 6 seconds
+		Traffic: TrafficShape{
+			Kind:          PacedTraffic,
+			Rate:          32 * 1024 * 500,
+			ChunkInterval: Duration(50 * time.Millisecond),
+			Spikes: []TrafficSpike{
+				{Start: Duration(1 * time.Second), End: Duration(3 * time.Second), Multiplier: 3},
+			},
 		},
 	}
+)
+
+func (p BenchmarkParameters) limit() int {
+	if p.Limit == 0 {
+		return math.MaxInt
+	}
+	return int(p.Limit)
 }
 
-func RunBenchmarkSpikeRecoveryRealWorldLocal() BenchmarkData {
-	golangSeries := RunGolangTest(SpikeRecoveryRealWorldLocalTest, []MonitorValueType{RX, CPU, RAM})
-	jujuSeries := RunJujuTest(SpikeRecoveryRealWorldLocalTest, []MonitorValueType{RX, CPU, RAM})
-	uberSeries := RunUberTest(SpikeRecoveryRealWorldLocalTest, []MonitorValueType{RX, CPU, RAM})
-	imadmonSeries := RunIMadmonTest(SpikeRecoveryRealWorldLocalTest, []MonitorValueType{RX, CPU, RAM})
-	return BenchmarkData{
-		GolangReader: {
-			RX:  golangSeries[RX],
-			CPU: golangSeries[CPU],
-			RAM: golangSeries[RAM],
-		},
-		JujuReader: {
-			RX:  jujuSeries[RX],
-			CPU: jujuSeries[CPU],
-			RAM: jujuSeries[RAM],
-		},
-		UberReader: {
-			RX:  uberSeries[RX],
-			CPU: uberSeries[CPU],
-			RAM: uberSeries[RAM],
-		},
-		IMadmonReader: {
-			RX:  imadmonSeries[RX],
-			CPU: imadmonSeries[CPU],
-			RAM: imadmonSeries[RAM],
-		},
+// LowRateLimits are the limits of the low rate benchmarks, below the 32KB buffer a read per second would take.
+var LowRateLimits = []ByteSize{1024, 8 * 1024, 32 * 1024}
+
+// LowRateScenarios read 4 seconds of data at every low rate limit with the classic io.Copy buffer.
+func LowRateScenarios() []Scenario {
+	return lo.Map(LowRateLimits, func(limit ByteSize, _ int) Scenario {
+		return Scenario{
+			Name:        fmt.Sprintf("BenchmarkLowRate%sSynthetic", formatByteSize(limit)),
+			Description: fmt.Sprintf("Passing 4 seconds of data with %s limit and 32KB buffer with synthetic reader", formatByteSize(limit)),
+			Source:      SyntheticSource,
+			DataSize:    4 * limit,
+			BufferSize:  32 * 1024, // 32KB classic io.Copy
+			Limit:       limit,
+			Monitors:    []MonitorValueType{ReadRX, CPU, ReadLatency, ReadGap},
+		}
+	})
+}
+
+// LimitStepsScenario steps the limit down and up mid-stream between 2 servers, 2 seconds at every limit.
+var LimitStepsScenario = Scenario{
+	Name:        "BenchmarkLimitStepsRealWorldLocal",
+	Description: "Rate limit between 2 servers stepping from 25MB/s to 5MB/s after 2 seconds and to 50MB/s after 4 seconds",
+	Source:      TCPSource,
+	DataSize:    160 * 1024 * 1024, // 50MB + 10MB + 100MB, should take 6 seconds
+	BufferSize:  32 * 1024,         // 32KB classic io.Copy
+	Limit:       25 * 1024 * 1024,
+	LimitSteps: []LimitStep{
+		{At: Duration(2 * time.Second), Limit: 5 * 1024 * 1024},
+		{At: Duration(4 * time.Second), Limit: 50 * 1024 * 1024},
+	},
+	Traffic:  TrafficShape{Kind: BulkTraffic},
+	Monitors: lo.Flatten([][]MonitorValueType{TCPMonitorValueTypes, ReadMonitorValueTypes}),
+}
+
+// scenarioBenchmarkDefinitions define built-in benchmarks described as scenarios.
+func scenarioBenchmarkDefinitions(scenarios ...Scenario) []BenchmarkDefinition {
+	return lo.Map(scenarios, func(scenario Scenario, _ int) BenchmarkDefinition {
+		return BenchmarkDefinition{
+			Type:       BenchmarkType(scenario.Name),
+			Parameters: scenario.Parameters(),
+			Run:        func(readers []RegisteredReader) BenchmarkData { return RunBenchmarkScenario(scenario, readers) },
+			Graph:      func(data BenchmarkData) []*charts.Line { return BenchmarkScenarioGraph(scenario, data) },
+		}
+	})
+}
+
+var BenchmarkDefinitions = append([]BenchmarkDefinition{
+	{
+		Type:       BenchmarkRateLimitingSynthetic,
+		Parameters: RateLimitingParameters,
+		Run:        RunBenchmarkRateLimitingSynthetic,
+		Graph:      BenchmarkRateLimitingSyntheticGraph,
+	},
+	{
+		Type:       BenchmarkRateLimitingRealWorldLocal,
+		Parameters: RateLimitingParameters,
+		Run:        RunBenchmarkRateLimitingRealWorldLocal,
+		Graph:      BenchmarkRateLimitingRealWorldLocalGraph,
+	},
+	{
+		Type:       BenchmarkMaxReadOverTimeSynthetic,
+		Parameters: MaxReadOverTimeParameters,
+		Run:        RunBenchmarkMaxReadOverTimeSynthetic,
+		Graph:      BenchmarkMaxReadOverTimeSyntheticGraph,
+	},
+	{
+		Type:       BenchmarkSpikeRecoveryRealWorldLocal,
+		Parameters: SpikeRecoveryParameters,
+		Run:        RunBenchmarkSpikeRecoveryRealWorldLocal,
+		Graph:      BenchmarkSpikeRecoveryRealWorldLocalGraph,
+	},
+	{
+		Type:       BenchmarkRateLimitingRealWorldWrite,
+		Parameters: RateLimitingParameters,
+		Run:        RunBenchmarkRateLimitingRealWorldWrite,
+		Graph:      BenchmarkRateLimitingRealWorldWriteGraph,
+	},
+	{
+		Type:       BenchmarkCancellation,
+		Parameters: CancellationParameters,
+		Run:        RunBenchmarkCancellation,
+		Graph:      BenchmarkCancellationGraph,
+	},
+	{
+		Type:       BenchmarkSharedLimitRealWorldLocal,
+		Parameters: SharedLimitParameters,
+		Run:        RunBenchmarkSharedLimitRealWorldLocal,
+		Graph:      BenchmarkSharedLimitRealWorldLocalGraph,
+	},
+	{
+		Type:       BenchmarkHierarchicalLimitRealWorldLocal,
+		Parameters: HierarchicalLimitParameters,
+		Run:        RunBenchmarkHierarchicalLimitRealWorldLocal,
+		Graph:      BenchmarkHierarchicalLimitRealWorldLocalGraph,
+	},
+}, scenarioBenchmarkDefinitions(append(LowRateScenarios(), LimitStepsScenario)...)...)
+
+func RunBenchmark(filter BenchmarkFilter) AllBenchmarkData {
+	readers := filter.SelectedReaders()
+	result := make(AllBenchmarkData)
+	for _, definition := range BenchmarkDefinitions {
+		if filter.Benchmarks.Match(string(definition.Type)) {
+			result[definition.Type] = definition.Run(readers)
+		}
 	}
+	return result
+}
+
+func RunBenchmarkRateLimitingSynthetic(readers []RegisteredReader) BenchmarkData {
+	monitors := lo.Flatten([][]MonitorValueType{{SyntheticRX}, RuntimeMonitorValueTypes, ReadMonitorValueTypes})
+	return RunReadersTest(readers, RateLimitingSyntheticTest, RateLimitingParameters, monitors)
+}
+
+func RunBenchmarkRateLimitingRealWorldLocal(readers []RegisteredReader) BenchmarkData {
+	monitors := lo.Flatten([][]MonitorValueType{TCPMonitorValueTypes, RuntimeMonitorValueTypes, ReadMonitorValueTypes})
+	return RunReadersTest(readers, RateLimitingRealWorldLocalTest, RateLimitingParameters, monitors)
+}
+
+func RunBenchmarkMaxReadOverTimeSynthetic(readers []RegisteredReader) BenchmarkData {
+	monitors := lo.Flatten([][]MonitorValueType{{TotalSyntheticRX, CPU}, RuntimeMonitorValueTypes, ReadMonitorValueTypes})
+	return RunReadersTest(readers, MaxReadOverTimeSyntheticTest, MaxReadOverTimeParameters, monitors)
+}
+
+func RunBenchmarkSpikeRecoveryRealWorldLocal(readers []RegisteredReader) BenchmarkData {
+	monitors := lo.Flatten([][]MonitorValueType{TCPMonitorValueTypes, RuntimeMonitorValueTypes, ReadMonitorValueTypes})
+	return RunReadersTest(readers, SpikeRecoveryRealWorldLocalTest, SpikeRecoveryParameters, monitors)
+}
+
+// RunBenchmarkRateLimitingRealWorldWrite runs the writers of the selected readers.
+func RunBenchmarkRateLimitingRealWorldWrite(readers []RegisteredReader) BenchmarkData {
+	return RunWritersTest(selectedWriters(readers), RateLimitingRealWorldWriteTest, RateLimitingParameters, writeBenchmarkMonitors())
+}
+
+// writeBenchmarkMonitors returns the monitors of the write benchmark, the allocations per Read do not apply to writers.
+func writeBenchmarkMonitors() []MonitorValueType {
+	return lo.Flatten([][]MonitorValueType{TCPTXMonitorValueTypes, lo.Without(RuntimeMonitorValueTypes, AllocsPerRead), WriteMonitorValueTypes})
 }
 
 func RateLimitingSyntheticTest(readerFactory ReaderFactory) {
-	const dataSize = 100 * 1024 * 1024 // 100MB
-	const bufferSize = 32 * 1024       // 32KB classic io.Copy
-	const limit = dataSize / 4         // should take 4 seconds
+	dataSize := int(RateLimitingParameters.DataSize)
+	bufferSize := int(RateLimitingParameters.BufferSize)
+	limit := RateLimitingParameters.limit()
 	var total int
 
-	reader := &syntheticReader{size: dataSize}
+	reader := &syntheticReader{size: uint64(dataSize)}
 	limitedReader := readerFactory(reader, bufferSize, limit)
 	buffer := make([]byte, bufferSize)
 
@@ -172,10 +271,10 @@ func RateLimitingSyntheticTest(readerFactory ReaderFactory) {
 }
 
 func MaxReadOverTimeSyntheticTest(readerFactory ReaderFactory) {
-	const durationInSeconds = 10
-	const bufferSize = 32 * 1024 // 32KB classic io.Copy
-	const limit = math.MaxInt    // bufferSize * 1_000_000_000 // large limit
-	fmt.Printf("Duration set: %d seconds\n", durationInSeconds)
+	duration := time.Duration(MaxReadOverTimeParameters.Duration)
+	bufferSize := int(MaxReadOverTimeParameters.BufferSize)
+	limit := MaxReadOverTimeParameters.limit()
+	fmt.Printf("Duration set: %v\n", duration)
 
 	buffer := make([]byte, bufferSize)
 	var totalBytes int64
@@ -183,7 +282,7 @@ func MaxReadOverTimeSyntheticTest(readerFactory ReaderFactory) {
 	reader := &syntheticReader{}
 	rateLimitedReader := readerFactory(reader, bufferSize, limit)
 
-	deadline := time.Now().Add(durationInSeconds * time.Second)
+	deadline := time.Now().Add(duration)
 	for time.Now().Before(deadline) {
 		n, err := rateLimitedReader.Read(buffer)
 		if n > 0 {
@@ -196,13 +295,13 @@ func MaxReadOverTimeSyntheticTest(readerFactory ReaderFactory) {
 	}
 
 	mb := float64(totalBytes) / 1024.0 / 1024.0
-	fmt.Printf("MaxReadOverTimeSyntheticTest: Read %.3f MB in 10 seconds\n", mb)
+	fmt.Printf("MaxReadOverTimeSyntheticTest: Read %.3f MB in %v\n", mb, duration)
 }
 
 func RateLimitingRealWorldLocalTest(readerFactory ReaderFactory) {
-	const dataSize = 100 * 1024 * 1024 // 100MB
-	const bufferSize = 32 * 1024       // 32KB classic io.Copy
-	const limit = dataSize / 4         // should take 4 seconds
+	dataSize := int(RateLimitingParameters.DataSize)
+	bufferSize := int(RateLimitingParameters.BufferSize)
+	limit := RateLimitingParameters.limit()
 	var elapsed time.Duration
 
 	rf := func(connReader io.ReadCloser) (int, error) {
@@ -231,16 +330,11 @@ func RateLimitingRealWorldLocalTest(readerFactory ReaderFactory) {
 		return total, err
 	}
 
-	wf := func(connWriter io.Writer) (int, error) {
-		message := strings.Repeat("A", dataSize)
-		return connWriter.Write([]byte(message))
-	}
-
 	go func() {
 		// give the server a sec to start
 		time.Sleep(100 * time.Millisecond)
 
-		n, err := sendTCPMessage(wf)
+		n, err := sendTraffic(dataSize, TrafficShape{Kind: BulkTraffic})
 		if err != nil {
 			fmt.Println("Failed to send message:", err)
 		}
@@ -260,6 +354,63 @@ func RateLimitingRealWorldLocalTest(readerFactory ReaderFactory) {
 	fmt.Printf("RateLimitingRealWorldLocalTest Took %v\n", elapsed)
 }
 
+// RateLimitingRealWorldWriteTest mirrors RateLimitingRealWorldLocalTest on the write path,
+// the sender is limited and the server reads as fast as it can.
+func RateLimitingRealWorldWriteTest(writerFactory WriterFactory) {
+	dataSize := int(RateLimitingParameters.DataSize)
+	bufferSize := int(RateLimitingParameters.BufferSize)
+	limit := RateLimitingParameters.limit()
+	var elapsed time.Duration
+
+	wf := func(connWriter io.WriteCloser) (int, error) {
+		rateLimitedWriter := writerFactory(connWriter, bufferSize, limit)
+
+		var total int
+		buffer := []byte(strings.Repeat("A", bufferSize))
+		start := time.Now()
+		for total < dataSize {
+			n, err := rateLimitedWriter.Write(buffer[:min(bufferSize, dataSize-total)])
+			total += n
+			if err != nil {
+				fmt.Printf("Unexpected error while writing: %v\n", err)
+				return total, err
+			}
+		}
+
+		elapsed = time.Since(start)
+		return total, rateLimitedWriter.Close()
+	}
+
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		// give the server a sec to start
+		time.Sleep(100 * time.Millisecond)
+
+		n, err := sendTCPMessage(wf)
+		if err != nil {
+			fmt.Println("Failed to send message:", err)
+		}
+		if n != dataSize {
+			fmt.Printf("Failed to send message: sent insufficient size=%d expectedSize=%d\n", n, dataSize)
+		}
+	}()
+
+	n, err := receiveOnceTCPServer(func(connReader io.ReadCloser) (int, error) {
+		n, err := io.Copy(io.Discard, connReader)
+		return int(n), err
+	})
+	if err != nil {
+		fmt.Printf("Unexpected error from server: %v\n", err)
+	}
+	if n != dataSize {
+		fmt.Printf("Failed to get message: got insufficient size=%d expectedSize=%d\n", n, dataSize)
+	}
+	<-sent
+
+	fmt.Printf("RateLimitingRealWorldWriteTest Took %v\n", elapsed)
+}
+
 func RateLimitingRealWorldServerTest(readerFactory ReaderFactory) {
 	const dataSize = 100 * 1024 * 1024 // 100MB
 	const bufferSize = 32 * 1024       // 32KB classic io.Copy
@@ -304,12 +455,9 @@ func RateLimitingRealWorldServerTest(readerFactory ReaderFactory) {
 }
 
 func SpikeRecoveryRealWorldLocalTest(readerFactory ReaderFactory) {
-	const dataSize = 100 * 1024 * 1024 // 100MB
-	const bufferSize = 32 * 1024       // 32KB classic io.Copy
-	const limit = bufferSize * 500     // should take 6 seconds
-	//const a = limit / bufferSize
-	//const b = 1000 / a
-	//const c = dataSize / limit
+	dataSize := int(SpikeRecoveryParameters.DataSize)
+	bufferSize := int(SpikeRecoveryParameters.BufferSize)
+	limit := SpikeRecoveryParameters.limit()
 	var elapsed time.Duration
 
 	rf := func(connReader io.ReadCloser) (int, error) {
@@ -338,44 +486,11 @@ func SpikeRecoveryRealWorldLocalTest(readerFactory ReaderFactory) {
 		return total, err
 	}
 
-	wf := func(connWriter io.Writer) (int, error) {
-		chunkIntervalsMilliseconds := 50
-		chunkSize := limit / (1000 / chunkIntervalsMilliseconds)
-		spikedChunkSize := chunkSize * 3
-		var total int
-		var chunkCounter int
-		chunkCounterSpikeStart := 1000 / chunkIntervalsMilliseconds     // at 1 second
-		chunkCounterSpikeEnd := 3 * (1000 / chunkIntervalsMilliseconds) // at 3 second
-		ticker := time.NewTicker(time.Duration(chunkIntervalsMilliseconds) * time.Millisecond)
-		defer ticker.Stop()
-
-		for total < dataSize {
-			select {
-			case <-ticker.C:
-				chunkCounter++
-				size := chunkSize
-				if chunkCounter > chunkCounterSpikeStart && chunkCounter < chunkCounterSpikeEnd {
-					size = spikedChunkSize
-				}
-
-				message := strings.Repeat("A", size)
-				n, err := connWriter.Write([]byte(message))
-				total += n
-				if err != nil {
-					fmt.Printf("Unexpected error while writing: %v\n", err)
-					return total, err
-				}
-			}
-		}
-
-		return total, nil
-	}
-
 	go func() {
 		// give the server a sec to start
 		time.Sleep(100 * time.Millisecond)
 
-		n, err := sendTCPMessage(wf)
+		n, err := sendTraffic(dataSize, SpikeRecoveryParameters.Traffic)
 		if err != nil {
 			fmt.Println("Failed to send message:", err)
 		}
@@ -437,3 +552,18 @@ func SpikeRecoveryRealWorldServerTest(readerFactory ReaderFactory) {
 
 	fmt.Printf("SpikeRecoveryRealWorldLocalTest Took %v\n", elapsed)
 }
+
+func RunBenchmarkScenarios(scenarios []Scenario, filter BenchmarkFilter) AllBenchmarkData {
+	readers := filter.SelectedReaders()
+	result := make(AllBenchmarkData)
+	for _, scenario := range scenarios {
+		if filter.Benchmarks.Match(scenario.Name) {
+			result[BenchmarkType(scenario.Name)] = RunBenchmarkScenario(scenario, readers)
+		}
+	}
+	return result
+}
+
+func RunBenchmarkScenario(scenario Scenario, readers []RegisteredReader) BenchmarkData {
+	return RunReadersTest(readers, scenario.BenchmarkTest(), scenario.Parameters(), scenario.Monitors)
+}
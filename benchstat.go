@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const benchstatPackage = "github.com/imadmon/limitedreader-benchmark"
+
+// WriteBenchstat writes the reader summaries in the Go benchmark format, a line per iteration of every
+// benchmark and reader, so the results can be compared with benchstat. Every iteration counts as a single op.
+func WriteBenchstat(w io.Writer, results ...BenchmarkResults) {
+	if len(results) == 0 {
+		return
+	}
+
+	if metadata := results[0].Metadata; metadata != nil {
+		fmt.Fprintf(w, "goos: %s\ngoarch: %s\npkg: %s\n", metadata.OS, metadata.Arch, benchstatPackage)
+		if metadata.CPUModel != "" {
+			fmt.Fprintf(w, "cpu: %s\n", metadata.CPUModel)
+		}
+	}
+
+	for _, result := range results {
+		for _, benchmarkType := range sortedBenchmarkTypes(result.Benchmarks) {
+			data := result.Benchmarks[benchmarkType]
+			for _, readerType := range sortedReaderTypes(data) {
+				series, ok := data[readerType].SummarySeries()
+				if !ok {
+					continue
+				}
+				name := benchstatField(string(benchmarkType)) + "/" + benchstatField(string(readerType))
+				if !strings.HasPrefix(name, "Benchmark") {
+					name = "Benchmark" + name
+				}
+				for _, summary := range series.Summary.Samples() {
+					fmt.Fprintln(w, benchstatLine(name, summary))
+				}
+			}
+		}
+	}
+}
+
+func benchstatLine(name string, s BenchmarkSummary) string {
+	line := fmt.Sprintf("%s\t1\t%d ns/op\t%.2f MB/s\t%.0f B/op\t%.0f allocs/op\t%.4f cv\t%.3f cpu-sec/op",
+		name, s.Elapsed.Nanoseconds(), s.Throughput/1e6, s.AllocBytes, s.Allocs, s.CV, s.CPUSeconds)
+	if s.Limit > 0 {
+		line += fmt.Sprintf("\t%.2f throughput-error%%\t%.2f max-overshoot%%", s.ErrorPercent, s.MaxOvershootPercent)
+	}
+	return line
+}
+
+// benchstatField makes a scenario or reader name a single field, benchstat splits lines on whitespace.
+func benchstatField(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
+
+func saveBenchstatToFile(filename string, results ...BenchmarkResults) {
+	if filename == "" {
+		return
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Printf("Cannot create file: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	WriteBenchstat(file, results...)
+	fmt.Printf("Saved benchstat output to file: %v\n", filename)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/samber/lo"
+)
+
+// CancellationParameters let a buffer through per second, the Read after the burst blocks for about a second.
+var CancellationParameters = BenchmarkParameters{
+	BufferSize: 32 * 1024, // 32KB classic io.Copy
+	Limit:      32 * 1024,
+}
+
+const (
+	cancellationAttempts = 5
+	cancellationDelay    = 200 * time.Millisecond // time the Read blocks before it is canceled
+	cancellationSettle   = 10 * time.Millisecond  // time the reading goroutine gets to exit before counting goroutines
+	cancellationTimeout  = 10 * time.Second
+)
+
+// CancellationSummary holds whether a reader blocked in the limiter returned on cancellation and what it left running.
+type CancellationSummary struct {
+	Attempts            int
+	ReturnedError       float64 // Reads that returned the cancellation error, whether or not they waited the limiter out first
+	Uninterrupted       float64 // Reads that waited the limiter out instead of returning on the cancellation
+	LeakedGoroutines    float64 // goroutines left running right after the Read returned, average of the attempts
+	LingeringGoroutines float64 // goroutines still running once the interrupted wait would have ended, average of the attempts
+	PendingTimers       float64 // adapter timers still pending right after the Read returned, average of the attempts
+}
+
+// Interruptible reports whether the cancellation interrupted the blocked Reads, their latency measures the limiter
+// only then. The libraries sleeping uninterrupted are reported without it.
+func (s *CancellationSummary) Interruptible() bool {
+	return s.Uninterrupted < float64(s.Attempts)
+}
+
+type cancellationAttempt struct {
+	latency       time.Duration
+	returnedErr   bool
+	uninterrupted bool
+	leaked        int
+	lingering     int
+	pendingTimers int64
+}
+
+// RunBenchmarkCancellation cancels the context of the readers taking one, and closes every reader, while blocked in a wait.
+func RunBenchmarkCancellation(readers []RegisteredReader) BenchmarkData {
+	result := make(BenchmarkData)
+	for _, reader := range readers {
+		readerData := make(BenchmarkReaderData)
+		if reader.ContextFactory != nil {
+			readerData[CancelLatency] = measureCancellation(reader, CancelLatency)
+		}
+		readerData[CloseLatency] = measureCancellation(reader, CloseLatency)
+		result[reader.Type] = readerData
+	}
+	return result
+}
+
+func measureCancellation(reader RegisteredReader, monitor MonitorValueType) SeriesData {
+	bufferSize := int(CancellationParameters.BufferSize)
+	limit := CancellationParameters.limit()
+	fmt.Printf("Starting %s of %s...\n", monitor, reader.Type)
+
+	var latencies durationHistogram
+	summary := &CancellationSummary{Attempts: cancellationAttempts}
+	values := make([]float64, 0, cancellationAttempts)
+	for i := 0; i < cancellationAttempts; i++ {
+		attempt := cancelBlockedRead(reader, monitor, bufferSize, limit)
+		latencies.Record(attempt.latency)
+		values = append(values, attempt.latency.Seconds())
+		if attempt.returnedErr {
+			summary.ReturnedError++
+		}
+		if attempt.uninterrupted {
+			summary.Uninterrupted++
+		}
+		summary.LeakedGoroutines += float64(attempt.leaked) / cancellationAttempts
+		summary.LingeringGoroutines += float64(attempt.lingering) / cancellationAttempts
+		summary.PendingTimers += float64(attempt.pendingTimers) / cancellationAttempts
+	}
+
+	percentiles := latencies.Percentiles()
+	fmt.Printf("%s %s: %v | returned error %.0f/%d | waited out %.0f/%d | leaked goroutines %.1f, after the wait %.1f | pending timers %.1f\n",
+		reader.Type, monitor, percentiles, summary.ReturnedError, summary.Attempts, summary.Uninterrupted, summary.Attempts,
+		summary.LeakedGoroutines, summary.LingeringGoroutines, summary.PendingTimers)
+	return SeriesData{
+		Title:        string(reader.Type),
+		Values:       values,
+		Unit:         monitorUnits[monitor],
+		Color:        reader.Color,
+		Percentiles:  &percentiles,
+		Cancellation: summary,
+	}
+}
+
+// cancelBlockedRead cancels the context, or closes the reader, while its Read waits for the limiter.
+// The first Read takes the burst so the second one blocks.
+func cancelBlockedRead(reader RegisteredReader, monitor MonitorValueType, bufferSize, limit int) cancellationAttempt {
+	goroutines := runtime.NumGoroutine()
+	timers := PendingTimers.Load()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var limitedReader io.ReadCloser
+	if monitor == CancelLatency {
+		limitedReader = reader.ContextFactory(ctx, &syntheticReader{}, bufferSize, limit)
+	} else {
+		limitedReader = reader.Factory(&syntheticReader{}, bufferSize, limit)
+	}
+	defer limitedReader.Close()
+	limitedReader.Read(make([]byte, bufferSize))
+
+	type readResult struct {
+		end time.Time
+		err error
+	}
+	readC := make(chan readResult, 1)
+	start := time.Now()
+	go func() {
+		_, err := limitedReader.Read(make([]byte, bufferSize))
+		readC <- readResult{end: time.Now(), err: err}
+	}()
+
+	time.Sleep(cancellationDelay)
+	canceledAt := time.Now()
+	if monitor == CancelLatency {
+		cancel()
+	} else {
+		limitedReader.Close()
+	}
+
+	// a Read returning past half of the wait left after the cancellation slept through it
+	wait := time.Duration(float64(bufferSize) / float64(limit) * float64(time.Second))
+	interruptedWithin := (wait - cancellationDelay) / 2
+
+	var attempt cancellationAttempt
+	select {
+	case result := <-readC:
+		// a Read that returned before the cancellation did not block, it took no time to cancel
+		attempt.latency = max(result.end.Sub(canceledAt), 0)
+		attempt.returnedErr = result.err != nil
+		attempt.uninterrupted = attempt.latency > interruptedWithin
+	case <-time.After(cancellationTimeout):
+		fmt.Printf("%s Read did not return %v after %s\n", reader.Type, cancellationTimeout, monitor)
+		attempt.latency = cancellationTimeout
+		attempt.uninterrupted = true
+	}
+	attempt.pendingTimers = max(PendingTimers.Load()-timers, 0)
+	time.Sleep(cancellationSettle)
+	attempt.leaked = max(runtime.NumGoroutine()-goroutines, 0)
+
+	// wait out the limiter wait the cancellation interrupted, goroutines still sleeping in it have exited by then
+	time.Sleep(time.Until(start.Add(wait + cancellationDelay)))
+	attempt.lingering = max(runtime.NumGoroutine()-goroutines, 0)
+	return attempt
+}
+
+func BenchmarkCancellationGraph(data BenchmarkData) []*charts.Line {
+	title := "Cancellation"
+	subtitle := "Canceling the context or closing the reader 200ms into a 1 second limiter wait"
+	return []*charts.Line{
+		GeneratePercentilesChart(
+			title+" - Context Cancel Latency Percentiles Microseconds",
+			subtitle,
+			interruptibleSeries(RegisteredReadersSeries(data, CancelLatency)),
+		),
+		GeneratePercentilesChart(
+			title+" - Close Latency Percentiles Microseconds",
+			subtitle,
+			interruptibleSeries(RegisteredReadersSeries(data, CloseLatency)),
+		),
+	}
+}
+
+// interruptibleSeries leaves out the readers the cancellation did not interrupt, their latency is the limiter wait.
+func interruptibleSeries(series []SeriesData) []SeriesData {
+	return lo.Filter(series, func(s SeriesData, _ int) bool { return s.Cancellation == nil || s.Cancellation.Interruptible() })
+}
+
+// cancellationTable formats the cancellation series of the readers, a row per reader and cancellation kind.
+func cancellationTable(benchmarkType BenchmarkType, data BenchmarkData) summaryTable {
+	table := summaryTable{
+		title: string(benchmarkType) + " Cancellation",
+		header: []string{"Reader", "Cancel By", "Latency p50", "Latency Max", "Returned Error", "Leaked Goroutines", "After Wait",
+			"Pending Timers"},
+	}
+	cancelBy := map[MonitorValueType]string{CancelLatency: "Context", CloseLatency: "Close"}
+	for _, readerType := range sortedReaderTypes(data) {
+		for _, monitor := range []MonitorValueType{CancelLatency, CloseLatency} {
+			series, ok := data[readerType][monitor]
+			if !ok || series.Cancellation == nil || series.Percentiles == nil {
+				continue
+			}
+			c := series.Cancellation
+			p50, maxLatency := "uninterruptible", "uninterruptible"
+			if c.Interruptible() {
+				p50 = series.Percentiles.P50.Round(time.Microsecond).String()
+				maxLatency = series.Percentiles.Max.Round(time.Microsecond).String()
+			}
+			table.rows = append(table.rows, []string{
+				string(readerType),
+				cancelBy[monitor],
+				p50,
+				maxLatency,
+				fmt.Sprintf("%.0f/%d", c.ReturnedError, c.Attempts),
+				fmt.Sprintf("%.1f", c.LeakedGoroutines),
+				fmt.Sprintf("%.1f", c.LingeringGoroutines),
+				fmt.Sprintf("%.1f", c.PendingTimers),
+			})
+		}
+	}
+	return table
+}
+
+// getBenchmarkReaderCancellationAverage averages the cancellation summaries of the iterations that recorded them.
+func getBenchmarkReaderCancellationAverage(benchmarkResults []AllBenchmarkData, benchmarkType BenchmarkType, readerType ReaderType, monitorType MonitorValueType) *CancellationSummary {
+	summaries := lo.FilterMap(benchmarkResults, func(benchmarkResult AllBenchmarkData, _ int) (*CancellationSummary, bool) {
+		summary := benchmarkResult[benchmarkType][readerType][monitorType].Cancellation
+		return summary, summary != nil
+	})
+	if len(summaries) == 0 {
+		return nil
+	}
+
+	var sum CancellationSummary
+	for _, summary := range summaries {
+		sum.Attempts += summary.Attempts
+		sum.ReturnedError += summary.ReturnedError
+		sum.Uninterrupted += summary.Uninterrupted
+		sum.LeakedGoroutines += summary.LeakedGoroutines
+		sum.LingeringGoroutines += summary.LingeringGoroutines
+		sum.PendingTimers += summary.PendingTimers
+	}
+	amount := float64(len(summaries))
+	return &CancellationSummary{
+		Attempts:            sum.Attempts,
+		ReturnedError:       sum.ReturnedError,
+		Uninterrupted:       sum.Uninterrupted,
+		LeakedGoroutines:    sum.LeakedGoroutines / amount,
+		LingeringGoroutines: sum.LingeringGoroutines / amount,
+		PendingTimers:       sum.PendingTimers / amount,
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+type Command struct {
+	Name        string
+	Description string
+	Run         func(args []string) error
+	Hidden      bool
+}
+
+var Commands = []Command{
+	{
+		Name:        "run",
+		Description: "Run the benchmark once, save its data and render its graphs",
+		Run:         benchmarkCommand,
+	},
+	{
+		Name:        "load",
+		Description: "Render graphs from a previously saved benchmark data file",
+		Run:         loadCommand,
+	},
+	{
+		Name:        "average",
+		Description: "Run the benchmark multiple times and save the average of all iterations",
+		Run:         averageCommand,
+	},
+	{
+		Name:        "repeat",
+		Description: "Run the benchmark multiple times and save every iteration separately",
+		Run:         repeatCommand,
+	},
+	{
+		Name:        "scenario",
+		Description: "Run the benchmark scenarios described in scenario files",
+		Run:         scenarioCommand,
+	},
+	{
+		Name:        "compare",
+		Description: "Compare the summaries of two saved data files and report regressions",
+		Run:         compareCommand,
+	},
+	{
+		Name:        "readers",
+		Description: "List the registered rate limited readers and writers",
+		Run:         readersCommand,
+	},
+	{
+		Name:        "usage",
+		Description: "Render the libraries usage graphs",
+		Run:         usageCommand,
+	},
+	{
+		Name:        "sender",
+		Description: "Send TCP traffic to the benchmark server, used by split mode",
+		Run:         senderCommand,
+		Hidden:      true,
+	},
+}
+
+func RunCommand(args []string) int {
+	if len(args) == 0 {
+		printCommandsUsage(os.Stderr)
+		return 2
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		printCommandsUsage(os.Stdout)
+		return 0
+	}
+
+	for _, command := range Commands {
+		if command.Name != name {
+			continue
+		}
+
+		err := command.Run(args[1:])
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n", name)
+	printCommandsUsage(os.Stderr)
+	return 2
+}
+
+func printCommandsUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: limitedreader-benchmark <command> [flags]\n\nCommands:\n")
+	for _, command := range Commands {
+		if command.Hidden {
+			continue
+		}
+		fmt.Fprintf(w, "  %-10s %s\n", command.Name, command.Description)
+	}
+	fmt.Fprintf(w, "\nRun 'limitedreader-benchmark <command> -h' for the command flags.\n")
+}
+
+func newCommandFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: limitedreader-benchmark %s [flags]\n\nFlags:\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func parseCommandFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	return nil
+}
+
+func addFilterFlags(fs *flag.FlagSet) *BenchmarkFilter {
+	filter := &BenchmarkFilter{}
+	fs.Func("benchmarks", "comma separated glob `patterns` of benchmarks to include, e.g. \"*Synthetic\"", func(value string) error {
+		filter.Benchmarks.Include = append(filter.Benchmarks.Include, parsePatterns(value)...)
+		return nil
+	})
+	fs.Func("skip-benchmarks", "comma separated glob `patterns` of benchmarks to exclude", func(value string) error {
+		filter.Benchmarks.Exclude = append(filter.Benchmarks.Exclude, parsePatterns(value)...)
+		return nil
+	})
+	fs.Func("readers", "comma separated glob `patterns` of readers to include, e.g. \"Golang,IMadmon\"", func(value string) error {
+		filter.Readers.Include = append(filter.Readers.Include, parsePatterns(value)...)
+		return nil
+	})
+	fs.Func("skip-readers", "comma separated glob `patterns` of readers to exclude", func(value string) error {
+		filter.Readers.Exclude = append(filter.Readers.Exclude, parsePatterns(value)...)
+		return nil
+	})
+	return filter
+}
+
+func addSplitSenderFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&splitSender, "split", splitSender, "send TCP traffic from a child process and monitor it separately")
+}
+
+func addRXInterfaceFlag(fs *flag.FlagSet) {
+	fs.StringVar(&rxInterface, "interface", rxInterface, "network `interface` whose received bytes are recorded as RX, empty for all the interfaces")
+}
+
+func addSharedConnectionsFlag(fs *flag.FlagSet) {
+	fs.Func("connections", fmt.Sprintf("`amount` of TCP clients sharing a limiter in the shared limit benchmark (default %d)", sharedConnections),
+		func(value string) error {
+			connections, err := strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+			if connections < 1 {
+				return fmt.Errorf("connections must be at least 1")
+			}
+			sharedConnections = connections
+			return nil
+		})
+}
+
+func addMonitorIntervalFlag(fs *flag.FlagSet) {
+	usage := fmt.Sprintf("monitors sampling `interval`, below %v only the in-process byte counters are sampled (default %v)",
+		fullMonitorMinInterval, defaultMonitorInterval)
+	fs.Func("interval", usage, func(value string) error {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if interval < minMonitorInterval {
+			return fmt.Errorf("interval must be at least %v", minMonitorInterval)
+		}
+		monitorInterval = interval
+		return nil
+	})
+}
+
+func addBenchstatFlag(fs *flag.FlagSet) *string {
+	return fs.String("benchstat", "", "also write the summaries in the Go benchmark format to `file`, for benchstat")
+}
+
+func parseFilterCommandFlags(fs *flag.FlagSet, filter *BenchmarkFilter, args []string) error {
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	return filter.Validate()
+}
+
+func benchmarkCommand(args []string) error {
+	fs := newCommandFlagSet("run")
+	filter := addFilterFlags(fs)
+	addSplitSenderFlag(fs)
+	addRXInterfaceFlag(fs)
+	addMonitorIntervalFlag(fs)
+	addSharedConnectionsFlag(fs)
+	dataFile := fs.String("data", benchmarkDataFile, "output `file` for the benchmark data")
+	graphFile := fs.String("graph", benchmarkGraphFile, "output `file` for the benchmark graphs")
+	benchstatFile := addBenchstatFlag(fs)
+	if err := parseFilterCommandFlags(fs, filter, args); err != nil {
+		return err
+	}
+
+	return Benchmark(*filter, *dataFile, *graphFile, *benchstatFile)
+}
+
+func loadCommand(args []string) error {
+	fs := newCommandFlagSet("load")
+	filter := addFilterFlags(fs)
+	dataFile := fs.String("data", benchmarkDataFile, "input `file` with saved benchmark data")
+	graphFile := fs.String("graph", benchmarkGraphFile, "output `file` for the benchmark graphs")
+	benchstatFile := addBenchstatFlag(fs)
+	if err := parseFilterCommandFlags(fs, filter, args); err != nil {
+		return err
+	}
+
+	return LoadBenchmark(*filter, *dataFile, *graphFile, *benchstatFile)
+}
+
+func averageCommand(args []string) error {
+	fs := newCommandFlagSet("average")
+	filter := addFilterFlags(fs)
+	addSplitSenderFlag(fs)
+	addRXInterfaceFlag(fs)
+	addMonitorIntervalFlag(fs)
+	addSharedConnectionsFlag(fs)
+	iterations := fs.Int("n", benchmarkAverageAmount, "number of benchmark iterations to average")
+	fs.Func("statistic", fmt.Sprintf("per sample `statistic` of the iterations graphed as the series, %q or %q (default %q)",
+		MeanStatistic, MedianStatistic, MeanStatistic), func(value string) error {
+		statistic := AverageStatistic(value)
+		if err := statistic.Validate(); err != nil {
+			return err
+		}
+		averageStatistic = statistic
+		return nil
+	})
+	dataFile := fs.String("data", benchmarkAverageDataFile, "output `file` for the averaged benchmark data")
+	graphFile := fs.String("graph", benchmarkAverageGraphFile, "output `file` for the averaged benchmark graphs")
+	benchstatFile := addBenchstatFlag(fs)
+	if err := parseFilterCommandFlags(fs, filter, args); err != nil {
+		return err
+	}
+
+	return BenchmarkWithAverage(*filter, *iterations, *dataFile, *graphFile, *benchstatFile)
+}
+
+func compareCommand(args []string) error {
+	fs := newCommandFlagSet("compare")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: limitedreader-benchmark compare [flags] <baseline file> <candidate file>\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	filter := addFilterFlags(fs)
+	markdown := fs.Bool("markdown", false, "print the report as markdown tables")
+	alpha := fs.Float64("alpha", 0.05, "p-value below which a difference is significant")
+	failOnRegression := fs.Bool("fail", false, "exit with an error when a metric regressed")
+	graphFile := fs.String("graph", compareGraphFile, "output `file` for the comparison graphs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("expected a baseline and a candidate data file, got %d arguments", fs.NArg())
+	}
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	return Compare(*filter, fs.Arg(0), fs.Arg(1), *markdown, *alpha, *failOnRegression, *graphFile)
+}
+
+func repeatCommand(args []string) error {
+	fs := newCommandFlagSet("repeat")
+	filter := addFilterFlags(fs)
+	addSplitSenderFlag(fs)
+	addRXInterfaceFlag(fs)
+	addMonitorIntervalFlag(fs)
+	addSharedConnectionsFlag(fs)
+	iterations := fs.Int("n", benchmarkMultipleAmount, "number of benchmark iterations to run")
+	dataFile := fs.String("data", benchmarkDataFile, "output `file` for the benchmark data, numbered per iteration")
+	graphFile := fs.String("graph", benchmarkGraphFile, "output `file` for the benchmark graphs, numbered per iteration")
+	benchstatFile := addBenchstatFlag(fs)
+	if err := parseFilterCommandFlags(fs, filter, args); err != nil {
+		return err
+	}
+
+	return BenchmarkMultipleTimes(*filter, *iterations, *dataFile, *graphFile, *benchstatFile)
+}
+
+func scenarioCommand(args []string) error {
+	fs := newCommandFlagSet("scenario")
+	filter := addFilterFlags(fs)
+	addSplitSenderFlag(fs)
+	addRXInterfaceFlag(fs)
+	addMonitorIntervalFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: limitedreader-benchmark scenario [flags] <scenario file>...\n\nScenario files are JSON, or YAML with a .yaml or .yml extension.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	dataFile := fs.String("data", scenariosDataFile, "output `file` for the scenarios data, or input file with -load")
+	graphFile := fs.String("graph", scenariosGraphFile, "output `file` for the scenarios graphs")
+	benchstatFile := addBenchstatFlag(fs)
+	load := fs.Bool("load", false, "render graphs from previously saved scenarios data instead of running the scenarios")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing scenario files")
+	}
+
+	scenarios := make([]Scenario, 0)
+	for _, filename := range fs.Args() {
+		fileScenarios, err := LoadScenariosFromFile(filename)
+		if err != nil {
+			return err
+		}
+		scenarios = append(scenarios, fileScenarios...)
+	}
+
+	if *load {
+		return LoadBenchmarkScenarios(scenarios, *filter, *dataFile, *graphFile, *benchstatFile)
+	}
+	return BenchmarkScenarios(scenarios, *filter, *dataFile, *graphFile, *benchstatFile)
+}
+
+func usageCommand(args []string) error {
+	fs := newCommandFlagSet("usage")
+	addMonitorIntervalFlag(fs)
+	graphFile := fs.String("graph", usageGraphFile, "output `file` for the usage graphs")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	return Usage(*graphFile)
+}
+
+func readersCommand(args []string) error {
+	fs := newCommandFlagSet("readers")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	for _, reader := range RegisteredReaders() {
+		fmt.Printf("%-10s %s  %s\n", reader.Type, reader.Color, reader.Description)
+	}
+
+	fmt.Println("\nWriters:")
+	for _, writer := range RegisteredWriters() {
+		fmt.Printf("%-10s %s  %s\n", writer.Type, writer.Color, writer.Description)
+	}
+	return nil
+}
+
+func senderCommand(args []string) error {
+	fs := newCommandFlagSet("sender")
+	address := fs.String("address", serverAddress, "benchmark server `address`")
+	dataSize := fs.Int("size", 0, "amount of bytes to send")
+	trafficJSON := fs.String("traffic", "{}", "traffic shape as `json`")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	var traffic TrafficShape
+	if err := json.Unmarshal([]byte(*trafficJSON), &traffic); err != nil {
+		return fmt.Errorf("invalid traffic: %w", err)
+	}
+
+	serverAddress = *address
+	n, err := sendTCPMessage(trafficWriteFunc(*dataSize, traffic))
+	fmt.Printf(senderSentFormat+"\n", n)
+	if err != nil {
+		return err
+	}
+	if n != *dataSize {
+		return fmt.Errorf("sent insufficient size=%d expectedSize=%d", n, *dataSize)
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/samber/lo"
+)
+
+// comparisonMetric is a summary metric compared between two data files.
+type comparisonMetric struct {
+	Name   string
+	Value  func(s BenchmarkSummary) float64
+	Format func(value float64) string
+	Points bool // percent valued, the delta is reported in percentage points instead of relative to the baseline
+	// Better is 1 when higher values are better, -1 when lower values are and 0 when neither,
+	// e.g. the throughput of a limited test should match the limit rather than grow.
+	Better func(limited bool) int
+}
+
+var comparisonMetrics = []comparisonMetric{
+	{
+		Name:   "Throughput",
+		Value:  func(s BenchmarkSummary) float64 { return s.Throughput },
+		Format: formatRate,
+		Better: func(limited bool) int { return lo.Ternary(limited, 0, 1) },
+	},
+	{
+		Name:   "Abs Error",
+		Value:  func(s BenchmarkSummary) float64 { return math.Abs(s.ErrorPercent) },
+		Format: func(value float64) string { return fmt.Sprintf("%.2f%%", value) },
+		Points: true,
+		Better: func(bool) int { return -1 },
+	},
+	{
+		Name:   "CV",
+		Value:  func(s BenchmarkSummary) float64 { return s.CV },
+		Format: func(value float64) string { return fmt.Sprintf("%.3f", value) },
+		Better: func(bool) int { return -1 },
+	},
+	{
+		Name:   "Max Overshoot",
+		Value:  func(s BenchmarkSummary) float64 { return s.MaxOvershootPercent },
+		Format: func(value float64) string { return fmt.Sprintf("%.2f%%", value) },
+		Points: true,
+		Better: func(bool) int { return -1 },
+	},
+	{
+		Name:   "CPU Seconds",
+		Value:  func(s BenchmarkSummary) float64 { return s.CPUSeconds },
+		Format: func(value float64) string { return fmt.Sprintf("%.2f", value) },
+		Better: func(bool) int { return -1 },
+	},
+}
+
+type ComparisonVerdict string
+
+const (
+	Improved       ComparisonVerdict = "improved"
+	Regressed      ComparisonVerdict = "regressed"
+	Changed        ComparisonVerdict = "changed"
+	NotSignificant ComparisonVerdict = "~"
+	Untested       ComparisonVerdict = "?" // a side has a single iteration
+)
+
+// MetricComparison compares a summary metric of a reader in a benchmark between the baseline and the candidate.
+type MetricComparison struct {
+	Benchmark BenchmarkType
+	Reader    ReaderType
+	Color     string
+	Metric    comparisonMetric
+	Baseline  []float64
+	Candidate []float64
+	Delta     float64 // relative to the baseline mean in percent, or percentage points for percent metrics, NaN when undefined
+	PValue    float64 // two sided Welch's t-test, NaN when untested
+	Verdict   ComparisonVerdict
+}
+
+// CompareResults compares the summaries of every reader recorded in both results, a difference counts
+// when its p-value is below alpha.
+func CompareResults(baseline, candidate BenchmarkResults, filter BenchmarkFilter, alpha float64) []MetricComparison {
+	baselineData, candidateData := filter.Apply(baseline.Benchmarks), filter.Apply(candidate.Benchmarks)
+
+	comparisons := make([]MetricComparison, 0)
+	for _, benchmarkType := range sortedBenchmarkTypes(baselineData) {
+		if _, ok := candidateData[benchmarkType]; !ok {
+			continue
+		}
+		for _, readerType := range sortedReaderTypes(baselineData[benchmarkType]) {
+			baselineSeries, ok := baselineData[benchmarkType][readerType].SummarySeries()
+			candidateSeries, candidateOk := candidateData[benchmarkType][readerType].SummarySeries()
+			if !ok || !candidateOk {
+				continue
+			}
+
+			limited := baselineSeries.Summary.Limit > 0
+			for _, metric := range comparisonMetrics {
+				comparisons = append(comparisons, compareMetric(MetricComparison{
+					Benchmark: benchmarkType,
+					Reader:    readerType,
+					Color:     baselineSeries.Color,
+					Metric:    metric,
+					Baseline:  lo.Map(baselineSeries.Summary.Samples(), func(s BenchmarkSummary, _ int) float64 { return metric.Value(s) }),
+					Candidate: lo.Map(candidateSeries.Summary.Samples(), func(s BenchmarkSummary, _ int) float64 { return metric.Value(s) }),
+				}, limited, alpha))
+			}
+		}
+	}
+	return comparisons
+}
+
+func compareMetric(comparison MetricComparison, limited bool, alpha float64) MetricComparison {
+	baselineMean, _ := meanStdDev(comparison.Baseline)
+	candidateMean, _ := meanStdDev(comparison.Candidate)
+	switch {
+	case comparison.Metric.Points:
+		comparison.Delta = candidateMean - baselineMean
+	case baselineMean != 0:
+		comparison.Delta = (candidateMean - baselineMean) / baselineMean * 100
+	default:
+		comparison.Delta = math.NaN()
+	}
+
+	comparison.PValue = welchTTest(comparison.Baseline, comparison.Candidate)
+	switch {
+	case math.IsNaN(comparison.PValue):
+		comparison.Verdict = Untested
+	case comparison.PValue >= alpha:
+		comparison.Verdict = NotSignificant
+	default:
+		direction := comparison.Metric.Better(limited) * int(math.Copysign(1, candidateMean-baselineMean))
+		comparison.Verdict = map[int]ComparisonVerdict{1: Improved, -1: Regressed, 0: Changed}[direction]
+	}
+	return comparison
+}
+
+// comparisonTables formats the comparisons per benchmark, preceded by the limiter modules whose version changed.
+func comparisonTables(baseline, candidate BenchmarkResults, comparisons []MetricComparison) []summaryTable {
+	tables := make([]summaryTable, 0)
+
+	modules := summaryTable{title: "Module Changes", header: []string{"Module", "Baseline", "Candidate"}}
+	if baseline.Metadata != nil && candidate.Metadata != nil {
+		paths := lo.Uniq(append(lo.Keys(baseline.Metadata.Modules), lo.Keys(candidate.Metadata.Modules)...))
+		sort.Strings(paths)
+		for _, path := range paths {
+			baselineVersion, candidateVersion := baseline.Metadata.Modules[path], candidate.Metadata.Modules[path]
+			if baselineVersion != candidateVersion {
+				modules.rows = append(modules.rows, []string{path, lo.CoalesceOrEmpty(baselineVersion, "-"), lo.CoalesceOrEmpty(candidateVersion, "-")})
+			}
+		}
+	}
+	if len(modules.rows) > 0 {
+		tables = append(tables, modules)
+	}
+
+	for _, benchmarkComparisons := range lo.PartitionBy(comparisons, func(c MetricComparison) BenchmarkType { return c.Benchmark }) {
+		table := summaryTable{
+			title:  string(benchmarkComparisons[0].Benchmark) + " Comparison",
+			header: []string{"Reader", "Metric", "Baseline", "Candidate", "Delta", "n", "p-value", "Verdict"},
+		}
+		for _, c := range benchmarkComparisons {
+			delta, pValue := "-", "-"
+			if !math.IsNaN(c.Delta) {
+				delta = fmt.Sprintf("%+.2f%%", c.Delta)
+				if c.Metric.Points {
+					delta = fmt.Sprintf("%+.2fpp", c.Delta)
+				}
+			}
+			if !math.IsNaN(c.PValue) {
+				pValue = fmt.Sprintf("%.3f", c.PValue)
+			}
+			table.rows = append(table.rows, []string{
+				string(c.Reader),
+				c.Metric.Name,
+				formatComparisonSamples(c.Metric, c.Baseline),
+				formatComparisonSamples(c.Metric, c.Candidate),
+				delta,
+				fmt.Sprintf("%d/%d", len(c.Baseline), len(c.Candidate)),
+				pValue,
+				string(c.Verdict),
+			})
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// formatComparisonSamples formats the samples mean with their relative standard deviation, like benchstat.
+func formatComparisonSamples(metric comparisonMetric, samples []float64) string {
+	mean, stdDev := meanStdDev(samples)
+	if len(samples) < 2 || mean == 0 {
+		return metric.Format(mean)
+	}
+	return fmt.Sprintf("%s ±%.0f%%", metric.Format(mean), stdDev/math.Abs(mean)*100)
+}
+
+// PrintComparisonReport writes the comparison tables as aligned text or as markdown.
+func PrintComparisonReport(w io.Writer, markdown bool, baseline, candidate BenchmarkResults, comparisons []MetricComparison) {
+	tables := comparisonTables(baseline, candidate, comparisons)
+	if markdown {
+		printTablesMarkdown(w, tables)
+	} else {
+		printTables(w, tables)
+	}
+
+	regressions := lo.CountBy(comparisons, func(c MetricComparison) bool { return c.Verdict == Regressed })
+	improvements := lo.CountBy(comparisons, func(c MetricComparison) bool { return c.Verdict == Improved })
+	fmt.Fprintf(w, "\n%d regressions, %d improvements out of %d compared metrics\n", regressions, improvements, len(comparisons))
+}
+
+// GraphComparison renders the deltas of every benchmark below the comparison tables.
+func GraphComparison(baseline, candidate BenchmarkResults, comparisons []MetricComparison, filename string) {
+	graphs := make([]*charts.Line, 0)
+	for _, benchmarkComparisons := range lo.PartitionBy(comparisons, func(c MetricComparison) BenchmarkType { return c.Benchmark }) {
+		graphs = append(graphs, GenerateComparisonChart(
+			string(benchmarkComparisons[0].Benchmark)+" - Candidate Delta",
+			"Percent change from the baseline, percentage points for percent metrics",
+			benchmarkComparisons,
+		))
+	}
+
+	WriteGraphsPageToFile("Comparison echarts", tablesHTML(comparisonTables(baseline, candidate, comparisons)), graphs, filename)
+}
+
+// GenerateComparisonChart graphs the metric deltas of every reader, leaving gaps where a delta is undefined.
+func GenerateComparisonChart(title, subtitle string, comparisons []MetricComparison) *charts.Line {
+	graph := NewCategoryChart(title, subtitle, lo.Map(comparisonMetrics, func(metric comparisonMetric, _ int) string { return metric.Name }))
+
+	for _, readerComparisons := range lo.PartitionBy(comparisons, func(c MetricComparison) ReaderType { return c.Reader }) {
+		items := lo.Map(readerComparisons, func(c MetricComparison, _ int) opts.LineData {
+			if math.IsNaN(c.Delta) {
+				return opts.LineData{Value: "-"}
+			}
+			return opts.LineData{Value: c.Delta}
+		})
+		AddCategorySeries(graph, string(readerComparisons[0].Reader), readerComparisons[0].Color, items)
+	}
+
+	return graph
+}
+
+func meanStdDev(samples []float64) (mean, stdDev float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	mean = lo.Sum(samples) / float64(len(samples))
+	if len(samples) < 2 {
+		return mean, 0
+	}
+	var variance float64
+	for _, sample := range samples {
+		variance += math.Pow(sample-mean, 2)
+	}
+	return mean, math.Sqrt(variance / float64(len(samples)-1))
+}
+
+// welchTTest returns the two sided p-value of Welch's t-test, which does not assume equal variances.
+// It is NaN when a side has less than two samples.
+func welchTTest(a, b []float64) float64 {
+	if len(a) < 2 || len(b) < 2 {
+		return math.NaN()
+	}
+	meanA, stdDevA := meanStdDev(a)
+	meanB, stdDevB := meanStdDev(b)
+	varA, varB := stdDevA*stdDevA/float64(len(a)), stdDevB*stdDevB/float64(len(b))
+	if varA+varB == 0 {
+		// constant samples, e.g. an untouched limit, differ for sure unless they are equal
+		return lo.Ternary(meanA == meanB, 1.0, 0.0)
+	}
+
+	t := (meanA - meanB) / math.Sqrt(varA+varB)
+	df := math.Pow(varA+varB, 2) / (varA*varA/float64(len(a)-1) + varB*varB/float64(len(b)-1))
+	return regularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// regularizedIncompleteBeta evaluates I_x(a, b) with its continued fraction, as in Numerical Recipes.
+func regularizedIncompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	lgammaA, _ := math.Lgamma(a)
+	lgammaB, _ := math.Lgamma(b)
+	lgammaAB, _ := math.Lgamma(a + b)
+	front := math.Exp(lgammaAB - lgammaA - lgammaB + a*math.Log(x) + b*math.Log(1-x))
+	if x > (a+1)/(a+b+2) {
+		// the continued fraction converges fast only below the mean, use the symmetry otherwise
+		return 1 - front*betaContinuedFraction(1-x, b, a)/b
+	}
+	return front * betaContinuedFraction(x, a, b) / a
+}
+
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-12
+		tiny          = 1e-300
+	)
+
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	result := d
+	for m := 1; m <= maxIterations; m++ {
+		m := float64(m)
+		for _, numerator := range []float64{
+			m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m)),
+			-(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1)),
+		} {
+			d = 1 + numerator*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + numerator/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			result *= d * c
+		}
+		if math.Abs(d*c-1) < epsilon {
+			break
+		}
+	}
+	return result
+}
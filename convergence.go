@@ -0,0 +1,139 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// LimitConvergence describes how a reader followed a limit step. Times are measured from the first sample with
+// data, so they are accurate to a sampling interval.
+type LimitConvergence struct {
+	At              time.Duration
+	Limit           float64       // bytes per second from the step on
+	Rate            float64       // average bytes per second returned until the next step or the test end
+	Converged       bool          // the rate got within the tolerance band before the next step or the test end
+	ConvergenceTime time.Duration // after the step until the rate stays within the tolerance band of the new limit
+}
+
+// NewLimitConvergences analyzes the limit steps, intervalsBytes are the samples from the first read.
+// The tolerance band is the one spikes settle into.
+func NewLimitConvergences(intervalsBytes []uint64, interval time.Duration, parameters BenchmarkParameters) []LimitConvergence {
+	steps := parameters.LimitSteps
+	if len(steps) == 0 || len(intervalsBytes) == 0 {
+		return nil
+	}
+
+	convergences := make([]LimitConvergence, 0, len(steps))
+	for i, step := range steps {
+		at := time.Duration(step.At)
+		// the first sample starting after the step, the last sample is partial
+		startIndex := min(int(math.Ceil(float64(at)/float64(interval))), len(intervalsBytes)-1)
+		windowEnd := len(intervalsBytes) - 1
+		if i+1 < len(steps) {
+			windowEnd = min(int(time.Duration(steps[i+1].At)/interval), windowEnd)
+		}
+		windowEnd = max(windowEnd, startIndex)
+
+		limitPerInterval := float64(step.Limit) * interval.Seconds()
+		convergence := LimitConvergence{
+			At:              at,
+			Limit:           float64(step.Limit),
+			ConvergenceTime: max(time.Duration(windowEnd)*interval-at, 0),
+		}
+		if windowEnd > startIndex {
+			convergence.Rate = float64(lo.Sum(intervalsBytes[startIndex:windowEnd])) / (time.Duration(windowEnd-startIndex) * interval).Seconds()
+		}
+
+		for k := startIndex; k < windowEnd; k++ {
+			withinBand := lo.EveryBy(intervalsBytes[k:windowEnd], func(bytes uint64) bool {
+				return math.Abs(float64(bytes)-limitPerInterval) <= limitPerInterval*spikeSettlingTolerance
+			})
+			if withinBand {
+				convergence.Converged = true
+				convergence.ConvergenceTime = max(time.Duration(k)*interval-at, 0)
+				break
+			}
+		}
+
+		convergences = append(convergences, convergence)
+	}
+	return convergences
+}
+
+// limitAt returns the limit in effect at the elapsed time from the first Read.
+func (p BenchmarkParameters) limitAt(elapsed time.Duration) float64 {
+	limit := float64(p.Limit)
+	for _, step := range p.LimitSteps {
+		if elapsed < time.Duration(step.At) {
+			break
+		}
+		limit = float64(step.Limit)
+	}
+	return limit
+}
+
+// averageLimit returns the limit averaged over the elapsed time from the first Read, the limit itself without steps.
+func (p BenchmarkParameters) averageLimit(elapsed time.Duration) float64 {
+	if len(p.LimitSteps) == 0 || elapsed <= 0 {
+		return float64(p.Limit)
+	}
+
+	var allowed float64
+	from, limit := time.Duration(0), float64(p.Limit)
+	for _, step := range p.LimitSteps {
+		at := min(time.Duration(step.At), elapsed)
+		allowed += limit * (at - from).Seconds()
+		from, limit = at, float64(step.Limit)
+	}
+	allowed += limit * (elapsed - from).Seconds()
+	return allowed / elapsed.Seconds()
+}
+
+// scheduledElapsed returns how long reading the data size takes at the limit, following its steps.
+func (p BenchmarkParameters) scheduledElapsed() time.Duration {
+	remaining := float64(p.DataSize)
+	from, limit := time.Duration(0), float64(p.Limit)
+	for _, step := range p.LimitSteps {
+		stepBytes := limit * (time.Duration(step.At) - from).Seconds()
+		if stepBytes >= remaining {
+			break
+		}
+		remaining -= stepBytes
+		from, limit = time.Duration(step.At), float64(step.Limit)
+	}
+	return from + time.Duration(remaining/limit*float64(time.Second))
+}
+
+// getLimitConvergencesAverage averages every step over the iterations, a step counts as converged
+// only when it did in all of them.
+func getLimitConvergencesAverage(iterations [][]LimitConvergence) []LimitConvergence {
+	stepsAmount := len(lo.MaxBy(iterations, func(a, b []LimitConvergence) bool { return len(a) > len(b) }))
+	if stepsAmount == 0 {
+		return nil
+	}
+
+	result := make([]LimitConvergence, stepsAmount)
+	for i := range result {
+		var sum LimitConvergence
+		var amount float64
+		sum.Converged = true
+		for _, convergences := range iterations {
+			if i >= len(convergences) {
+				continue
+			}
+			convergence := convergences[i]
+			sum.At, sum.Limit = convergence.At, convergence.Limit
+			sum.Rate += convergence.Rate
+			sum.Converged = sum.Converged && convergence.Converged
+			sum.ConvergenceTime += convergence.ConvergenceTime
+			amount++
+		}
+
+		sum.Rate /= amount
+		sum.ConvergenceTime = time.Duration(float64(sum.ConvergenceTime) / amount)
+		result[i] = sum
+	}
+	return result
+}
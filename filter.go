@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Filter selects names by glob patterns (see path.Match).
+// An empty Include selects every name, Exclude is applied after Include.
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+type BenchmarkFilter struct {
+	Benchmarks Filter
+	Readers    Filter
+}
+
+func (f Filter) Match(name string) bool {
+	if len(f.Include) > 0 && !matchAnyPattern(f.Include, name) {
+		return false
+	}
+	return !matchAnyPattern(f.Exclude, name)
+}
+
+func (f Filter) Validate() error {
+	for _, pattern := range append(append([]string(nil), f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func matchAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+		// allow benchmark patterns without the common prefix, e.g. "SpikeRecovery*"
+		if matched, _ := path.Match(pattern, strings.TrimPrefix(name, "Benchmark")); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (f BenchmarkFilter) Validate() error {
+	if err := f.Benchmarks.Validate(); err != nil {
+		return err
+	}
+	if err := f.Readers.Validate(); err != nil {
+		return err
+	}
+	if len(f.SelectedReaders()) == 0 {
+		return fmt.Errorf("no registered reader matches the readers filter")
+	}
+	return nil
+}
+
+func (f BenchmarkFilter) SelectedReaders() []RegisteredReader {
+	selected := make([]RegisteredReader, 0)
+	for _, reader := range RegisteredReaders() {
+		if f.Readers.Match(string(reader.Type)) {
+			selected = append(selected, reader)
+		}
+	}
+	return selected
+}
+
+func (f BenchmarkFilter) Apply(data AllBenchmarkData) AllBenchmarkData {
+	result := make(AllBenchmarkData)
+	for benchmarkType, benchmarkData := range data {
+		if !f.Benchmarks.Match(string(benchmarkType)) {
+			continue
+		}
+
+		result[benchmarkType] = make(BenchmarkData)
+		for readerType, readerData := range benchmarkData {
+			if f.Readers.Match(string(readerType)) {
+				result[benchmarkType][readerType] = readerData
+			}
+		}
+	}
+	return result
+}
+
+// sortedBenchmarkTypes orders the benchmarks as defined, followed by the scenarios by name.
+func sortedBenchmarkTypes(data AllBenchmarkData) []BenchmarkType {
+	result := make([]BenchmarkType, 0, len(data))
+	defined := make(map[BenchmarkType]bool)
+	for _, definition := range BenchmarkDefinitions {
+		defined[definition.Type] = true
+		if _, ok := data[definition.Type]; ok {
+			result = append(result, definition.Type)
+		}
+	}
+
+	undefined := make([]BenchmarkType, 0)
+	for benchmarkType := range data {
+		if !defined[benchmarkType] {
+			undefined = append(undefined, benchmarkType)
+		}
+	}
+	sort.Slice(undefined, func(i, j int) bool { return undefined[i] < undefined[j] })
+
+	return append(result, undefined...)
+}
+
+// sortedReaderTypes returns the registered readers present in data in registration order,
+// followed by unregistered ones (e.g. from a loaded file) sorted by name.
+func sortedReaderTypes(data BenchmarkData) []ReaderType {
+	result := make([]ReaderType, 0, len(data))
+	registered := make(map[ReaderType]bool)
+	for _, reader := range RegisteredReaders() {
+		registered[reader.Type] = true
+		if _, ok := data[reader.Type]; ok {
+			result = append(result, reader.Type)
+		}
+	}
+
+	unregistered := make([]ReaderType, 0)
+	for readerType := range data {
+		if !registered[readerType] {
+			unregistered = append(unregistered, readerType)
+		}
+	}
+	sort.Slice(unregistered, func(i, j int) bool { return unregistered[i] < unregistered[j] })
+
+	return append(result, unregistered...)
+}
+
+func parsePatterns(value string) []string {
+	patterns := make([]string, 0)
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-echarts/go-echarts/v2/charts"
@@ -13,103 +15,109 @@ import (
 )
 
 type LineSeriesData struct {
-	Title  string
-	Values []float32
-	Color  string
+	Title    string
+	Values   []float32
+	Color    string
+	Interval time.Duration
+
+	// Low and High bound the confidence band drawn around Values, empty for series without one.
+	Low  []float32
+	High []float32
 }
 
-func GraphBenchmark(benchmark AllBenchmarkData, filename string) {
+func GraphBenchmark(benchmark AllBenchmarkData, filter BenchmarkFilter, filename string) {
+	benchmark = filter.Apply(benchmark)
 	graphs := make([]*charts.Line, 0)
+	for _, definition := range BenchmarkDefinitions {
+		if data, ok := benchmark[definition.Type]; ok {
+			graphs = append(graphs, definition.Graph(data)...)
+		}
+	}
 
-	graphs = append(graphs, BenchmarkRateLimitingSyntheticGraph(benchmark[BenchmarkRateLimitingSynthetic]))
-	graphs = append(graphs, BenchmarkRateLimitingRealWorldLocalGraph(benchmark[BenchmarkRateLimitingRealWorldLocal])...)
-	graphs = append(graphs, BenchmarkMaxReadOverTimeSyntheticGraph(benchmark[BenchmarkMaxReadOverTimeSynthetic])...)
-	graphs = append(graphs, BenchmarkSpikeRecoveryRealWorldLocalGraph(benchmark[BenchmarkSpikeRecoveryRealWorldLocal])...)
-
-	WriteGraphsToFile("Benchmark echarts", graphs, filename)
+	benchmarkTypes := lo.Map(BenchmarkDefinitions, func(definition BenchmarkDefinition, _ int) BenchmarkType { return definition.Type })
+	PrintSummaryTables(os.Stdout, benchmarkTypes, benchmark)
+	WriteGraphsPageToFile("Benchmark echarts", SummaryTablesHTML(benchmarkTypes, benchmark), graphs, filename)
 }
 
-func BenchmarkRateLimitingSyntheticGraph(data BenchmarkData) *charts.Line {
-	return GenerateGraphChart(
-		"Classic Usage Synthetic Rate Limiting - SyntheticRX MB",
-		"Passing X data with X/4 limit with synthetic reader",
-		nil,
-		MoveOverlappingSeriesData([]SeriesData{
-			data[GolangReader][SyntheticRX],
-			data[JujuReader][SyntheticRX],
-			data[UberReader][SyntheticRX],
-			data[IMadmonReader][SyntheticRX],
-		}),
-	)
+func BenchmarkRateLimitingSyntheticGraph(data BenchmarkData) []*charts.Line {
+	title := "Classic Usage Synthetic Rate Limiting"
+	subtitle := "Passing X data with X/4 limit with synthetic reader"
+	return append([]*charts.Line{
+		GenerateGraphChart(
+			title+" - SyntheticRX MB",
+			subtitle,
+			nil,
+			GraphReadersSeries(data, SyntheticRX),
+		),
+	}, append(RuntimeGraphs(title, subtitle, nil, data), ReadGraphs(title, subtitle, nil, data)...)...)
 }
 
 func BenchmarkRateLimitingRealWorldLocalGraph(data BenchmarkData) []*charts.Line {
 	title := "Real-World Rate Limiting"
 	subtitle := "Passing X data with X/4 limit between 2 servers"
-	return []*charts.Line{
+	return append([]*charts.Line{
 		GenerateGraphChart(
 			title+" - RX MB",
 			subtitle,
 			nil,
-			MoveOverlappingSeriesData([]SeriesData{
-				data[GolangReader][RX],
-				data[JujuReader][RX],
-				data[UberReader][RX],
-				data[IMadmonReader][RX],
-			}),
+			GraphReadersSeries(data, RX),
+		),
+		GenerateGraphChart(
+			title+" - Connection RX MB",
+			subtitle,
+			nil,
+			GraphReadersSeries(data, ConnRX),
 		),
 		GenerateGraphChart(
 			title+" - CPU Usage",
 			subtitle,
 			nil,
-			MoveOverlappingSeriesData([]SeriesData{
-				data[GolangReader][CPU],
-				data[JujuReader][CPU],
-				data[UberReader][CPU],
-				data[IMadmonReader][CPU],
-			}),
+			GraphReadersSeries(data, CPU),
 		),
 		GenerateGraphChart(
 			title+" - RAM MB Usage",
 			subtitle,
 			nil,
-			MoveOverlappingSeriesData([]SeriesData{
-				data[GolangReader][RAM],
-				data[JujuReader][RAM],
-				data[UberReader][RAM],
-				data[IMadmonReader][RAM],
-			}),
+			GraphReadersSeries(data, RAM),
 		),
-	}
+		GenerateGraphChart(
+			title+" - Go Heap MB",
+			subtitle,
+			nil,
+			GraphReadersSeries(data, GoHeap),
+		),
+		GenerateGraphChart(
+			title+" - Sender CPU Usage",
+			subtitle,
+			nil,
+			GraphReadersSeries(data, SenderCPU),
+		),
+		GenerateGraphChart(
+			title+" - Sender RAM MB Usage",
+			subtitle,
+			nil,
+			GraphReadersSeries(data, SenderRAM),
+		),
+	}, append(RuntimeGraphs(title, subtitle, nil, data), ReadGraphs(title, subtitle, nil, data)...)...)
 }
 
 func BenchmarkMaxReadOverTimeSyntheticGraph(data BenchmarkData) []*charts.Line {
 	title := "Max Read Over 10 Seconds"
 	subtitle := "Passing infinite data with no limit with synthetic reader"
-	return []*charts.Line{
+	return append([]*charts.Line{
 		GenerateGraphChart(
 			title+" - Total SyntheticRX MB",
 			subtitle,
 			nil,
-			MoveOverlappingSeriesData([]SeriesData{
-				data[GolangReader][TotalSyntheticRX],
-				data[JujuReader][TotalSyntheticRX],
-				data[UberReader][TotalSyntheticRX],
-				data[IMadmonReader][TotalSyntheticRX],
-			}),
+			GraphReadersSeries(data, TotalSyntheticRX),
 		),
 		GenerateGraphChart(
 			title+" - CPU Usage",
 			subtitle,
 			nil,
-			MoveOverlappingSeriesData([]SeriesData{
-				data[GolangReader][CPU],
-				data[JujuReader][CPU],
-				data[UberReader][CPU],
-				data[IMadmonReader][CPU],
-			}),
+			GraphReadersSeries(data, CPU),
 		),
-	}
+	}, append(RuntimeGraphs(title, subtitle, nil, data), ReadGraphs(title, subtitle, nil, data)...)...)
 }
 
 func BenchmarkSpikeRecoveryRealWorldLocalGraph(data BenchmarkData) []*charts.Line {
@@ -119,54 +127,217 @@ func BenchmarkSpikeRecoveryRealWorldLocalGraph(data BenchmarkData) []*charts.Lin
 		"Spike Start": 1.0,
 		"Spike End":   3.0,
 	}
-	return []*charts.Line{
+	return append([]*charts.Line{
 		GenerateGraphChart(
 			title+" - RX MB",
 			subtitle,
 			markLines,
-			MoveOverlappingSeriesData([]SeriesData{
-				data[GolangReader][RX],
-				data[JujuReader][RX],
-				data[UberReader][RX],
-				data[IMadmonReader][RX],
-			}),
+			GraphReadersSeries(data, RX),
+		),
+		GenerateGraphChart(
+			title+" - Connection RX MB",
+			subtitle,
+			markLines,
+			GraphReadersSeries(data, ConnRX),
 		),
 		GenerateGraphChart(
 			title+" - CPU Usage",
 			subtitle,
 			markLines,
-			MoveOverlappingSeriesData([]SeriesData{
-				data[GolangReader][CPU],
-				data[JujuReader][CPU],
-				data[UberReader][CPU],
-				data[IMadmonReader][CPU],
-			}),
+			GraphReadersSeries(data, CPU),
 		),
 		GenerateGraphChart(
 			title+" - RAM MB Usage",
 			subtitle,
 			markLines,
-			MoveOverlappingSeriesData([]SeriesData{
-				data[GolangReader][RAM],
-				data[JujuReader][RAM],
-				data[UberReader][RAM],
-				data[IMadmonReader][RAM],
-			}),
+			GraphReadersSeries(data, RAM),
+		),
+		GenerateGraphChart(
+			title+" - Go Heap MB",
+			subtitle,
+			markLines,
+			GraphReadersSeries(data, GoHeap),
+		),
+		GenerateGraphChart(
+			title+" - Sender CPU Usage",
+			subtitle,
+			markLines,
+			GraphReadersSeries(data, SenderCPU),
 		),
+		GenerateGraphChart(
+			title+" - Sender RAM MB Usage",
+			subtitle,
+			markLines,
+			GraphReadersSeries(data, SenderRAM),
+		),
+	}, append(RuntimeGraphs(title, subtitle, markLines, data), ReadGraphs(title, subtitle, markLines, data)...)...)
+}
+
+func BenchmarkRateLimitingRealWorldWriteGraph(data BenchmarkData) []*charts.Line {
+	title := "Real-World Write Rate Limiting"
+	subtitle := "Writing X data with X/4 limit between 2 servers"
+	return MonitorGraphs(title, subtitle, nil, data, writeBenchmarkMonitors())
+}
+
+func RuntimeGraphs(title, subtitle string, markLines map[string]float64, data BenchmarkData) []*charts.Line {
+	graphs := make([]*charts.Line, 0)
+	for _, monitor := range RuntimeMonitorValueTypes {
+		graphs = append(graphs, GenerateGraphChart(
+			title+" - "+monitorGraphTitles[monitor],
+			subtitle,
+			markLines,
+			GraphReadersSeries(data, monitor),
+		))
 	}
+	return graphs
+}
+
+// ReadGraphs graphs the benchmarked reader series over time, histogram series followed by their whole test percentiles.
+func ReadGraphs(title, subtitle string, markLines map[string]float64, data BenchmarkData) []*charts.Line {
+	return MonitorGraphs(title, subtitle, markLines, data, ReadMonitorValueTypes)
+}
+
+// WriteGraphs graphs the benchmarked writer series over time, like ReadGraphs.
+func WriteGraphs(title, subtitle string, markLines map[string]float64, data BenchmarkData) []*charts.Line {
+	return MonitorGraphs(title, subtitle, markLines, data, WriteMonitorValueTypes)
+}
+
+// MonitorGraphs graphs the monitors series over time, histogram series followed by their whole test percentiles.
+func MonitorGraphs(title, subtitle string, markLines map[string]float64, data BenchmarkData, monitors []MonitorValueType) []*charts.Line {
+	graphs := make([]*charts.Line, 0)
+	for _, monitor := range monitors {
+		graphs = append(graphs, GenerateGraphChart(
+			title+" - "+monitorGraphTitles[monitor],
+			subtitle,
+			markLines,
+			GraphReadersSeries(data, monitor),
+		))
+		if percentilesTitle, ok := percentilesGraphTitles[monitor]; ok {
+			graphs = append(graphs, GeneratePercentilesChart(
+				title+" - "+percentilesTitle,
+				subtitle,
+				RegisteredReadersSeries(data, monitor),
+			))
+		}
+	}
+	return graphs
+}
+
+var monitorGraphTitles = map[MonitorValueType]string{
+	RX:               "RX MB",
+	ConnRX:           "Connection RX MB",
+	ReadRX:           "Reader Output MB",
+	SyntheticRX:      "SyntheticRX MB",
+	TotalSyntheticRX: "Total SyntheticRX MB",
+	CPU:              "CPU Usage",
+	RAM:              "RAM MB Usage",
+	GoHeap:           "Go Heap MB",
+	SenderCPU:        "Sender CPU Usage",
+	SenderRAM:        "Sender RAM MB Usage",
+	HeapAllocs:       "Heap Allocations KB",
+	AllocsPerRead:    "Heap Allocations Per Read",
+	GCCycles:         "GC Cycles",
+	GCPause:          "GC Pause Microseconds",
+	Goroutines:       "Goroutines",
+	ReadLatency:      "Read Latency p99 Microseconds",
+	ReadGap:          "Read Gap p99 Microseconds",
+	TX:               "TX MB",
+	ConnTX:           "Connection TX MB",
+	WriteTX:          "Writer Input MB",
+	WriteLatency:     "Write Latency p99 Microseconds",
+}
+
+var percentilesGraphTitles = map[MonitorValueType]string{
+	ReadLatency:  "Read Latency Percentiles Microseconds",
+	ReadGap:      "Read Gap Percentiles Microseconds",
+	WriteLatency: "Write Latency Percentiles Microseconds",
+}
+
+func GraphScenarios(scenarios []Scenario, benchmark AllBenchmarkData, filter BenchmarkFilter, filename string) {
+	benchmark = filter.Apply(benchmark)
+	graphs := make([]*charts.Line, 0)
+	for _, scenario := range scenarios {
+		if data, ok := benchmark[BenchmarkType(scenario.Name)]; ok {
+			graphs = append(graphs, BenchmarkScenarioGraph(scenario, data)...)
+		}
+	}
+
+	benchmarkTypes := lo.Map(scenarios, func(scenario Scenario, _ int) BenchmarkType { return BenchmarkType(scenario.Name) })
+	PrintSummaryTables(os.Stdout, benchmarkTypes, benchmark)
+	WriteGraphsPageToFile("Scenarios echarts", SummaryTablesHTML(benchmarkTypes, benchmark), graphs, filename)
+}
+
+func BenchmarkScenarioGraph(scenario Scenario, data BenchmarkData) []*charts.Line {
+	subtitle := scenario.Description
+	if subtitle == "" {
+		subtitle = fmt.Sprintf("Passing %s data with %s limit using %s source",
+			formatByteSize(scenario.DataSize), formatByteSize(scenario.Limit), scenario.Source)
+	}
+
+	markLines := make(map[string]float64)
+	for i, spike := range scenario.Traffic.Spikes {
+		markLines[fmt.Sprintf("Spike %d Start", i+1)] = time.Duration(spike.Start).Seconds()
+		markLines[fmt.Sprintf("Spike %d End", i+1)] = time.Duration(spike.End).Seconds()
+	}
+	for i, step := range scenario.LimitSteps {
+		markLines[fmt.Sprintf("Step %d %s/s", i+1, formatByteSize(step.Limit))] = time.Duration(step.At).Seconds()
+	}
+
+	return MonitorGraphs(scenario.Name, subtitle, markLines, data, scenario.Monitors)
+}
+
+func formatByteSize(size ByteSize) string {
+	if size == 0 {
+		return "unlimited"
+	}
+	for _, unit := range byteSizeUnits {
+		if float64(size) >= unit.size {
+			return fmt.Sprintf("%g%s", float64(size)/unit.size, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+// GraphReadersSeries returns the registered readers series of the monitor in its display units, ready to be graphed.
+func GraphReadersSeries(data BenchmarkData, monitorType MonitorValueType) []LineSeriesData {
+	return MoveOverlappingSeriesData(DisplaySeries(RegisteredReadersSeries(data, monitorType), monitorType))
+}
+
+func RegisteredReadersSeries(data BenchmarkData, monitorType MonitorValueType) []SeriesData {
+	series := make([]SeriesData, 0)
+	for _, readerType := range sortedReaderTypes(data) {
+		if readerSeries, ok := data[readerType][monitorType]; ok {
+			series = append(series, readerSeries)
+		}
+	}
+	return series
 }
 
 func WriteGraphsToFile(graphPageTitle string, graphs []*charts.Line, graphFileName string) {
+	WriteGraphsPageToFile(graphPageTitle, "", graphs, graphFileName)
+}
+
+// WriteGraphsPageToFile renders the graphs below the headerHTML, e.g. the summary tables.
+func WriteGraphsPageToFile(graphPageTitle, headerHTML string, graphs []*charts.Line, graphFileName string) {
 	page := components.NewPage()
 	page.PageTitle = graphPageTitle
 
 	for _, graph := range graphs {
-		page.AddCharts(graph)
+		// skip graphs without any series, e.g. filtered out readers
+		if graph != nil && len(graph.MultiSeries) > 0 {
+			page.AddCharts(graph)
+		}
 	}
 
-	f, _ := os.Create(graphFileName)
-	defer f.Close()
-	page.Render(f)
+	var rendered bytes.Buffer
+	page.Render(&rendered)
+	pageHTML := strings.Replace(rendered.String(), "<body>", "<body>\n"+headerHTML, 1)
+
+	err := os.WriteFile(graphFileName, []byte(pageHTML), 0644)
+	if err != nil {
+		fmt.Printf("Cannot write graph: %v\n", err)
+		return
+	}
 	fmt.Printf("Graph rendered at %s\n", graphFileName)
 }
 
@@ -183,9 +354,11 @@ func StartGraphSeriesMonitor(seriesName, color string, seriesValueType MonitorVa
 
 	results := <-resultsC
 	return SeriesData{
-		Title:  seriesName,
-		Values: parseGraphValue(results, seriesValueType),
-		Color:  color,
+		Title:    seriesName,
+		Values:   parseGraphValue(results, seriesValueType),
+		Unit:     monitorUnits[seriesValueType],
+		Color:    color,
+		Interval: monitorInterval,
 	}
 }
 
@@ -206,10 +379,14 @@ func GenerateGraphChart(title, subtitle string, markLines map[string]float64, se
 		}),
 	)
 
-	axisSize := len(lo.MaxBy(series, func(a, b LineSeriesData) bool { return len(a.Values) >= len(b.Values) }).Values)
+	longestSeries := lo.MaxBy(series, func(a, b LineSeriesData) bool { return len(a.Values) >= len(b.Values) })
+	interval := longestSeries.Interval
+	if interval == 0 {
+		interval = defaultMonitorInterval
+	}
 	var xAxis []string
-	for i := 0.0; i < float64(axisSize/5); i += 0.2 {
-		xAxis = append(xAxis, fmt.Sprintf("%.1f", i))
+	for i := range longestSeries.Values {
+		xAxis = append(xAxis, formatAxisSeconds(time.Duration(i)*interval, interval))
 	}
 
 	graph.SetXAxis(xAxis)
@@ -237,6 +414,7 @@ func GenerateGraphChart(title, subtitle string, markLines map[string]float64, se
 			//	Opacity: 0.2,
 			//}),
 		)
+		addConfidenceBand(graph, s)
 	}
 
 	for markTitle, markDim := range markLines {
@@ -256,7 +434,7 @@ func GenerateGraphChart(title, subtitle string, markLines map[string]float64, se
 			}),
 			charts.WithMarkLineNameXAxisItemOpts(opts.MarkLineNameXAxisItem{
 				Name:     markTitle,
-				XAxis:    fmt.Sprintf("%.1f", markDim),
+				XAxis:    formatAxisSeconds(time.Duration(markDim*float64(time.Second)), interval),
 				ValueDim: "x",
 			}),
 		)
@@ -265,20 +443,138 @@ func GenerateGraphChart(title, subtitle string, markLines map[string]float64, se
 	return graph
 }
 
-func parseGraphValue(values []monitorResult, valueType MonitorValueType) []int {
-	mb := 1024 * 1024
-	return lo.Map(values, func(item monitorResult, _ int) int {
+// addConfidenceBand fills the area between the series Low and High, stacking the band height on an invisible
+// Low line. The band shares the series title so toggling the series in the legend toggles its band too.
+func addConfidenceBand(graph *charts.Line, s LineSeriesData) {
+	if len(s.Low) == 0 {
+		return
+	}
+
+	stack := "band " + s.Title
+	hidden := charts.WithLineStyleOpts(opts.LineStyle{Opacity: opts.Float(0)})
+	low := lo.Map(s.Low, func(value float32, _ int) opts.LineData { return opts.LineData{Value: value} })
+	height := lo.Map(s.High, func(value float32, i int) opts.LineData { return opts.LineData{Value: value - s.Low[i]} })
+
+	graph.AddSeries(s.Title, low, hidden,
+		charts.WithLineChartOpts(opts.LineChart{Stack: stack, ShowSymbol: opts.Bool(false)}),
+	)
+	graph.AddSeries(s.Title, height, hidden,
+		charts.WithLineChartOpts(opts.LineChart{Stack: stack, ShowSymbol: opts.Bool(false)}),
+		charts.WithAreaStyleOpts(opts.AreaStyle{Color: s.Color, Opacity: opts.Float(0.2)}),
+	)
+}
+
+// GeneratePercentilesChart compares the whole test percentiles of the series, skipping series recorded without them.
+func GeneratePercentilesChart(title, subtitle string, series []SeriesData) *charts.Line {
+	graph := NewCategoryChart(title, subtitle, []string{"p50", "p90", "p99", "max"})
+
+	for _, s := range series {
+		if s.Percentiles == nil {
+			continue
+		}
+		values := []time.Duration{s.Percentiles.P50, s.Percentiles.P90, s.Percentiles.P99, s.Percentiles.Max}
+		items := lo.Map(values, func(value time.Duration, _ int) opts.LineData {
+			return opts.LineData{Value: float64(value) / float64(time.Microsecond)}
+		})
+		AddCategorySeries(graph, s.Title, s.Color, items)
+	}
+
+	return graph
+}
+
+// NewCategoryChart returns a line chart comparing the readers over the categories of its x axis, rather than over time.
+func NewCategoryChart(title, subtitle string, categories []string) *charts.Line {
+	graph := charts.NewLine()
+	graph.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{
+			Title:    title,
+			Subtitle: subtitle,
+		}),
+		charts.WithLegendOpts(opts.Legend{
+			Left:  "right",
+			Top:   "top",
+			Align: "auto",
+		}),
+		charts.WithGridOpts(opts.Grid{
+			Top: "80px",
+		}),
+	)
+	graph.SetXAxis(categories)
+	return graph
+}
+
+// AddCategorySeries adds the values of a reader, one per category, marking every point.
+func AddCategorySeries(graph *charts.Line, name, color string, items []opts.LineData) {
+	graph.AddSeries(name, items,
+		charts.WithLineStyleOpts(opts.LineStyle{
+			Color: color,
+		}),
+		charts.WithItemStyleOpts(opts.ItemStyle{
+			Color: color,
+		}),
+		charts.WithLineChartOpts(opts.LineChart{
+			SymbolSize: 6,
+		}),
+	)
+}
+
+// formatAxisSeconds formats a sample time as an x axis label, rounded to the sampling interval
+// so mark lines land on an existing label.
+func formatAxisSeconds(d, interval time.Duration) string {
+	d = d.Round(interval)
+	precision := 0
+	for unit := time.Second; precision < 3 && interval%unit != 0; unit /= 10 {
+		precision++
+	}
+	return fmt.Sprintf("%.*f", precision, d.Seconds())
+}
+
+// parseGraphValue returns the raw samples of the value type, in its monitorUnits unit.
+func parseGraphValue(values []monitorResult, valueType MonitorValueType) []float64 {
+	return lo.Map(values, func(item monitorResult, _ int) float64 {
 		switch valueType {
 		case RX:
-			return int(item.rxDelta) / mb
+			return float64(item.rxDelta)
+		case ConnRX:
+			return float64(item.connRXDelta)
+		case ReadRX:
+			return float64(item.readRXDelta)
 		case SyntheticRX:
-			return int(item.syntheticRXDelta) / mb
+			return float64(item.syntheticRXDelta)
 		case TotalSyntheticRX:
-			return int(item.totalSyntheticRX) / mb
+			return float64(item.totalSyntheticRX)
 		case CPU:
-			return int(item.cpuPercent)
+			return item.cpuPercent
 		case RAM:
-			return int(item.ramMB)
+			return float64(item.ramBytes)
+		case GoHeap:
+			return float64(item.goHeapBytes)
+		case SenderCPU:
+			return item.senderCPUPercent
+		case SenderRAM:
+			return float64(item.senderRAMBytes)
+		case HeapAllocs:
+			return float64(item.heapAllocBytes)
+		case AllocsPerRead:
+			return item.allocsPerRead
+		case GCCycles:
+			return float64(item.gcCycles)
+		case GCPause:
+			return item.gcPauseSeconds
+		case Goroutines:
+			return float64(item.goroutines)
+		case ReadLatency:
+			return item.readLatencyP99.Seconds()
+		case ReadGap:
+			return item.readGapP99.Seconds()
+		case TX:
+			return float64(item.txDelta)
+		case ConnTX:
+			return float64(item.connTXDelta)
+		case WriteTX:
+			return float64(item.writeTXDelta)
+		case WriteLatency:
+			return item.writeLatencyP99.Seconds()
 		default:
 			return 0
 		}
@@ -286,24 +582,34 @@ func parseGraphValue(values []monitorResult, valueType MonitorValueType) []int {
 }
 
 func MoveOverlappingSeriesData(values []SeriesData) []LineSeriesData {
-	maxValue := 0
+	maxValue := 0.0
 	for _, v := range values {
 		currMaxValue := lo.Max(v.Values)
+		if v.Bands != nil {
+			currMaxValue = max(currMaxValue, lo.Max(v.Bands.P90))
+		}
 		if currMaxValue > maxValue {
 			maxValue = currMaxValue
 		}
 	}
 
-	yAxisSize := float32(maxValue) * 1.1
+	yAxisSize := float32(maxValue * 1.1)
 	deviation := yAxisSize / 150
 
 	result := make([]LineSeriesData, 0)
 	for i, v := range values {
-		result = append(result, LineSeriesData{
-			Title:  v.Title,
-			Color:  v.Color,
-			Values: lo.Map(v.Values, func(item, _ int) float32 { return float32(item) + (float32(i) * deviation) }),
-		})
+		move := func(item float64, _ int) float32 { return float32(item) + (float32(i) * deviation) }
+		series := LineSeriesData{
+			Title:    v.Title,
+			Color:    v.Color,
+			Interval: v.SampleInterval(),
+			Values:   lo.Map(v.Values, move),
+		}
+		if v.Bands != nil && v.Bands.Iterations > 1 {
+			series.Low = lo.Map(v.Bands.P10, move)
+			series.High = lo.Map(v.Bands.P90, move)
+		}
+		result = append(result, series)
 	}
 
 	return result
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/samber/lo"
+)
+
+// HierarchicalLimitParameters cap the aggregate rate of the priority classes, whose connection limits add up above it.
+var HierarchicalLimitParameters = BenchmarkParameters{
+	BufferSize: 32 * 1024, // 32KB classic io.Copy
+	Limit:      16 * 1024 * 1024,
+	Duration:   Duration(4 * time.Second),
+}
+
+// PriorityClass is a group of connections sharing a per connection limit.
+type PriorityClass struct {
+	Name        string
+	Connections int
+	Limit       ByteSize // bytes per second of every connection
+}
+
+// HierarchicalLimitClasses bind the low priority connections by their own limit and the high priority ones
+// by the global limit: the low ones take 6MB/s, leaving 5MB/s to each high one.
+var HierarchicalLimitClasses = []PriorityClass{
+	{Name: "High", Connections: 2, Limit: 8 * 1024 * 1024},
+	{Name: "Low", Connections: 6, Limit: 1024 * 1024},
+}
+
+// hierarchyCrossChains stack the connection limiter of a library inside the global limiter of another,
+// the bursty and the deterministic strategies react differently to the limit of the other.
+var hierarchyCrossChains = []struct {
+	Connection, Global ReaderType
+	Color              string
+}{
+	{GolangReader, UberReader, "#fc8452"}, // bursty connections under a deterministic global limit
+	{UberReader, GolangReader, "#9a60b4"}, // deterministic connections under a bursty global limit
+}
+
+const (
+	// hierarchyTolerance is the rate above a limit still counted as honoring it.
+	hierarchyTolerance = 0.05
+	// hierarchyWindow is the sliding window of the peak rates, a whole-duration average hides the bursts.
+	hierarchyWindow = time.Second
+)
+
+// PriorityClassSummary holds the rates the connections of a priority class got.
+type PriorityClassSummary struct {
+	Name        string
+	Connections int
+	Limit       float64 // bytes per second of every connection
+	FairShare   float64 // max-min fair bytes per second of every connection under both limits
+	Rate        float64 // average bytes per second of the connections
+	MinRate     float64
+	MaxRate     float64
+	PeakRate    float64 // highest bytes per second of a connection over a hierarchyWindow
+}
+
+// HierarchySummary holds whether the stacked limiters honored the connection and the global limits.
+type HierarchySummary struct {
+	GlobalLimit float64
+	Rate        float64 // aggregate bytes per second of all connections
+	PeakRate    float64 // highest aggregate bytes per second over a hierarchyWindow
+	Classes     []PriorityClassSummary
+}
+
+// GlobalHonored checks the peak rate, data recorded before it only has the average.
+func (s *HierarchySummary) GlobalHonored() bool {
+	return max(s.PeakRate, s.Rate) <= s.GlobalLimit*(1+hierarchyTolerance)
+}
+
+func (s PriorityClassSummary) Honored() bool {
+	return max(s.PeakRate, s.MaxRate) <= s.Limit*(1+hierarchyTolerance)
+}
+
+// NewHierarchySummary summarizes the bytes every connection read in every connectionBucket of the duration,
+// the connections are ordered by class.
+func NewHierarchySummary(connectionsBuckets [][]int, classes []PriorityClass, parameters BenchmarkParameters) *HierarchySummary {
+	duration := time.Duration(parameters.Duration)
+	rates := lo.Map(connectionsBuckets, func(buckets []int, _ int) float64 { return float64(lo.Sum(buckets)) / duration.Seconds() })
+	peakRates := lo.Map(connectionsBuckets, func(buckets []int, _ int) float64 { return peakWindowRate(buckets) })
+	connectionLimits := lo.Map(priorityConnectionLimits(classes), func(limit int, _ int) float64 { return float64(limit) })
+	fairShares := maxMinFairShares(connectionLimits, float64(parameters.Limit))
+
+	summary := &HierarchySummary{
+		GlobalLimit: float64(parameters.Limit),
+		Rate:        lo.Sum(rates),
+	}
+	if len(connectionsBuckets) > 0 {
+		aggregate := lo.Map(connectionsBuckets[0], func(_ int, bucket int) int {
+			return lo.SumBy(connectionsBuckets, func(buckets []int) int { return buckets[bucket] })
+		})
+		summary.PeakRate = peakWindowRate(aggregate)
+	}
+	var first int
+	for _, class := range classes {
+		classRates := rates[first : first+class.Connections]
+		summary.Classes = append(summary.Classes, PriorityClassSummary{
+			Name:        class.Name,
+			Connections: class.Connections,
+			Limit:       float64(class.Limit),
+			FairShare:   fairShares[first],
+			Rate:        lo.Sum(classRates) / float64(len(classRates)),
+			MinRate:     lo.Min(classRates),
+			MaxRate:     lo.Max(classRates),
+			PeakRate:    lo.Max(peakRates[first : first+class.Connections]),
+		})
+		first += class.Connections
+	}
+	return summary
+}
+
+// peakWindowRate returns the highest bytes per second of the buckets over a hierarchyWindow sliding over them.
+func peakWindowRate(buckets []int) float64 {
+	window := min(int(hierarchyWindow/connectionBucket), len(buckets))
+	var peak int
+	for i := 0; i+window <= len(buckets); i++ {
+		peak = max(peak, lo.Sum(buckets[i:i+window]))
+	}
+	return float64(peak) / (time.Duration(window) * connectionBucket).Seconds()
+}
+
+// priorityConnectionLimits returns the limit of every connection, ordered by class.
+func priorityConnectionLimits(classes []PriorityClass) []int {
+	return lo.FlatMap(classes, func(class PriorityClass, _ int) []int {
+		return lo.Times(class.Connections, func(_ int) int { return int(class.Limit) })
+	})
+}
+
+// maxMinFairShares fills the connections evenly up to their limits until the global limit runs out.
+func maxMinFairShares(limits []float64, globalLimit float64) []float64 {
+	shares := make([]float64, len(limits))
+	order := lo.Range(len(limits))
+	slices.SortFunc(order, func(a, b int) int { return cmp.Compare(limits[a], limits[b]) })
+
+	remaining := globalLimit
+	for i, connection := range order {
+		share := min(limits[connection], remaining/float64(len(order)-i))
+		shares[connection] = share
+		remaining -= share
+	}
+	return shares
+}
+
+// RunBenchmarkHierarchicalLimitRealWorldLocal reads the priority classes through a connection limiter stacked inside
+// a global one of the same library, skipping readers without a shared factory, then through the hierarchyCrossChains
+// of the selected readers.
+func RunBenchmarkHierarchicalLimitRealWorldLocal(readers []RegisteredReader) BenchmarkData {
+	monitors := lo.Flatten([][]MonitorValueType{TCPMonitorValueTypes, ReadMonitorValueTypes})
+
+	result := make(BenchmarkData)
+	for _, chain := range hierarchyChains(readers) {
+		var connectionsBuckets [][]int
+		run := func() {
+			fmt.Printf("Starting HierarchicalLimitRealWorldLocalTest using %s...\n", chain.Type)
+			connectionsBuckets = HierarchicalLimitRealWorldLocalTest(instrumentedReaderFactory(chain.Factory))
+			time.Sleep(250 * time.Millisecond)
+			fmt.Printf("Finished HierarchicalLimitRealWorldLocalTest using %s\n", chain.Type)
+			time.Sleep(250 * time.Millisecond)
+		}
+		readerData := runWithMonitor(run, ReadRX, HierarchicalLimitParameters, string(chain.Type), chain.Color, monitors)
+
+		series := readerData[ReadRX]
+		series.Hierarchy = NewHierarchySummary(connectionsBuckets, HierarchicalLimitClasses, HierarchicalLimitParameters)
+		readerData[ReadRX] = series
+		fmt.Printf("%s global: %s, peak %s over %v, limit %s\n", chain.Type, formatRate(series.Hierarchy.Rate),
+			formatRate(series.Hierarchy.PeakRate), hierarchyWindow, formatRate(series.Hierarchy.GlobalLimit))
+		for _, class := range series.Hierarchy.Classes {
+			fmt.Printf("%s %s priority: %s per connection (%s - %s), peak %s, limit %s, fair share %s\n", chain.Type, class.Name,
+				formatRate(class.Rate), formatRate(class.MinRate), formatRate(class.MaxRate), formatRate(class.PeakRate),
+				formatRate(class.Limit), formatRate(class.FairShare))
+		}
+		result[chain.Type] = readerData
+	}
+	return result
+}
+
+// hierarchyChain is a connection limiter stacked inside a global limiter.
+type hierarchyChain struct {
+	Type    ReaderType
+	Color   string
+	Factory ReaderFactory
+}
+
+// hierarchyChains stacks every reader with a shared factory inside itself, then the hierarchyCrossChains
+// whose readers are both selected.
+func hierarchyChains(readers []RegisteredReader) []hierarchyChain {
+	bufferSize := int(HierarchicalLimitParameters.BufferSize)
+	limit := HierarchicalLimitParameters.limit()
+	chain := func(chainType ReaderType, color string, connection, global RegisteredReader) hierarchyChain {
+		return hierarchyChain{
+			Type:    chainType,
+			Color:   color,
+			Factory: ChainedReaderFactory(connection.Factory, global.SharedFactory(bufferSize, limit)),
+		}
+	}
+
+	chains := make([]hierarchyChain, 0)
+	for _, reader := range readers {
+		if reader.SharedFactory != nil {
+			chains = append(chains, chain(reader.Type, reader.Color, reader, reader))
+		}
+	}
+	for _, cross := range hierarchyCrossChains {
+		connection, connectionOk := lo.Find(readers, func(r RegisteredReader) bool { return r.Type == cross.Connection })
+		global, globalOk := lo.Find(readers, func(r RegisteredReader) bool { return r.Type == cross.Global })
+		if connectionOk && globalOk && global.SharedFactory != nil {
+			chainType := ReaderType(fmt.Sprintf("%s in %s", cross.Connection, cross.Global))
+			chains = append(chains, chain(chainType, cross.Color, connection, global))
+		}
+	}
+	return chains
+}
+
+// HierarchicalLimitRealWorldLocalTest reads a connection per priority class connection for the duration,
+// returning the bytes read from every connection in every connectionBucket, ordered by class.
+func HierarchicalLimitRealWorldLocalTest(readerFactory ReaderFactory) [][]int {
+	connectionsBuckets := readConnectionsTest(readerFactory, HierarchicalLimitParameters, priorityConnectionLimits(HierarchicalLimitClasses))
+
+	duration := time.Duration(HierarchicalLimitParameters.Duration)
+	total := lo.SumBy(connectionsBuckets, func(buckets []int) int { return lo.Sum(buckets) })
+	fmt.Printf("HierarchicalLimitRealWorldLocalTest read %s over %d connections in %v\n",
+		formatRate(float64(total)/duration.Seconds()), len(connectionsBuckets), duration)
+	return connectionsBuckets
+}
+
+func BenchmarkHierarchicalLimitRealWorldLocalGraph(data BenchmarkData) []*charts.Line {
+	title := "Hierarchical Limit"
+	subtitle := fmt.Sprintf("%s connections reading for %v under a %s/s global limit",
+		formatPriorityClasses(HierarchicalLimitClasses), time.Duration(HierarchicalLimitParameters.Duration),
+		formatByteSize(HierarchicalLimitParameters.Limit))
+	return append(MonitorGraphs(title, subtitle, nil, data, []MonitorValueType{ConnRX, ReadRX, CPU, ReadLatency}),
+		priorityClassesChart(title+" - Connection Rates MB/s", subtitle, RegisteredReadersSeries(data, ReadRX)))
+}
+
+func formatPriorityClasses(classes []PriorityClass) string {
+	return lo.Reduce(classes, func(description string, class PriorityClass, i int) string {
+		if i > 0 {
+			description += " and "
+		}
+		return description + fmt.Sprintf("%d %s %s/s", class.Connections, class.Name, formatByteSize(class.Limit))
+	}, "")
+}
+
+// priorityClassesChart draws the average connection rate of every class, next to its max-min fair share.
+func priorityClassesChart(title, subtitle string, series []SeriesData) *charts.Line {
+	series = lo.Filter(series, func(s SeriesData, _ int) bool { return s.Hierarchy != nil })
+	if len(series) == 0 {
+		return NewCategoryChart(title, subtitle, nil)
+	}
+	classes := series[0].Hierarchy.Classes
+	graph := NewCategoryChart(title, subtitle, lo.Map(classes, func(class PriorityClassSummary, _ int) string { return class.Name }))
+
+	rateItems := func(classes []PriorityClassSummary, rate func(PriorityClassSummary) float64) []opts.LineData {
+		return lo.Map(classes, func(class PriorityClassSummary, _ int) opts.LineData { return opts.LineData{Value: rate(class) / mb} })
+	}
+	AddCategorySeries(graph, "Fair Share", "#999999", rateItems(classes, func(class PriorityClassSummary) float64 { return class.FairShare }))
+	for _, s := range series {
+		AddCategorySeries(graph, s.Title, s.Color, rateItems(s.Hierarchy.Classes, func(class PriorityClassSummary) float64 { return class.Rate }))
+	}
+
+	return graph
+}
+
+// hierarchyTable formats the priority classes of the readers stacking limiters, a row per reader and class.
+func hierarchyTable(benchmarkType BenchmarkType, data BenchmarkData) summaryTable {
+	table := summaryTable{
+		title: string(benchmarkType) + " Priority Classes",
+		header: []string{"Reader", "Class", "Connections", "Limit", "Fair Share", "Rate", "Slowest", "Fastest", "Peak",
+			"Connection Limit", "Global Peak", "Global Limit"},
+	}
+	honored := map[bool]string{true: "honored", false: "exceeded"}
+	for _, readerType := range sortedReaderTypes(data) {
+		series, ok := data[readerType].SummarySeries()
+		if !ok || series.Hierarchy == nil {
+			continue
+		}
+		h := series.Hierarchy
+		for _, class := range h.Classes {
+			table.rows = append(table.rows, []string{
+				string(readerType),
+				class.Name,
+				fmt.Sprintf("%d", class.Connections),
+				formatRate(class.Limit),
+				formatRate(class.FairShare),
+				formatRate(class.Rate),
+				formatRate(class.MinRate),
+				formatRate(class.MaxRate),
+				formatRate(class.PeakRate),
+				honored[class.Honored()],
+				formatRate(h.PeakRate),
+				honored[h.GlobalHonored()],
+			})
+		}
+	}
+	return table
+}
+
+// getBenchmarkReaderHierarchyAverage averages the hierarchy summaries of the iterations that recorded them.
+func getBenchmarkReaderHierarchyAverage(benchmarkResults []AllBenchmarkData, benchmarkType BenchmarkType, readerType ReaderType, monitorType MonitorValueType) *HierarchySummary {
+	summaries := lo.FilterMap(benchmarkResults, func(benchmarkResult AllBenchmarkData, _ int) (*HierarchySummary, bool) {
+		summary := benchmarkResult[benchmarkType][readerType][monitorType].Hierarchy
+		return summary, summary != nil
+	})
+	if len(summaries) == 0 {
+		return nil
+	}
+
+	amount := float64(len(summaries))
+	average := &HierarchySummary{
+		GlobalLimit: summaries[0].GlobalLimit,
+		Rate:        lo.SumBy(summaries, func(s *HierarchySummary) float64 { return s.Rate }) / amount,
+		PeakRate:    lo.SumBy(summaries, func(s *HierarchySummary) float64 { return s.PeakRate }) / amount,
+	}
+	for i, class := range summaries[0].Classes {
+		classes := lo.Map(summaries, func(s *HierarchySummary, _ int) PriorityClassSummary { return s.Classes[i] })
+		class.Rate = lo.SumBy(classes, func(c PriorityClassSummary) float64 { return c.Rate }) / amount
+		class.MinRate = lo.SumBy(classes, func(c PriorityClassSummary) float64 { return c.MinRate }) / amount
+		class.MaxRate = lo.SumBy(classes, func(c PriorityClassSummary) float64 { return c.MaxRate }) / amount
+		class.PeakRate = lo.SumBy(classes, func(c PriorityClassSummary) float64 { return c.PeakRate }) / amount
+		average.Classes = append(average.Classes, class)
+	}
+	return average
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// HDR-style log-linear buckets: values below histogramSubBuckets are exact, every following power of two range is
+// split into histogramSubBuckets/2 linear buckets, bounding the relative error to 2/histogramSubBuckets.
+const (
+	histogramSubBucketBits = 7
+	histogramSubBuckets    = 1 << histogramSubBucketBits
+	histogramHalfBuckets   = histogramSubBuckets / 2
+	histogramBuckets       = (64-histogramSubBucketBits)*histogramHalfBuckets + histogramSubBuckets
+)
+
+// durationHistogram records durations in nanoseconds, safe for recording while being snapshotted.
+type durationHistogram struct {
+	counts [histogramBuckets]atomic.Uint64
+	max    atomic.Uint64
+}
+
+type histogramCounts [histogramBuckets]uint64
+
+// Percentiles summarizes the recorded durations of a whole test.
+type Percentiles struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+func (h *durationHistogram) Record(d time.Duration) {
+	value := uint64(max(d, 0))
+	h.counts[histogramBucket(value)].Add(1)
+	for {
+		currMax := h.max.Load()
+		if value <= currMax || h.max.CompareAndSwap(currMax, value) {
+			return
+		}
+	}
+}
+
+func (h *durationHistogram) Reset() {
+	for i := range h.counts {
+		h.counts[i].Store(0)
+	}
+	h.max.Store(0)
+}
+
+func (h *durationHistogram) Snapshot() *histogramCounts {
+	var counts histogramCounts
+	for i := range h.counts {
+		counts[i] = h.counts[i].Load()
+	}
+	return &counts
+}
+
+// Percentiles returns the recorded quantiles, bounded by the exact max which the bucket middles may exceed.
+func (h *durationHistogram) Percentiles() Percentiles {
+	counts := h.Snapshot()
+	maxDuration := time.Duration(h.max.Load())
+	return Percentiles{
+		P50: min(counts.Quantile(0.50), maxDuration),
+		P90: min(counts.Quantile(0.90), maxDuration),
+		P99: min(counts.Quantile(0.99), maxDuration),
+		Max: maxDuration,
+	}
+}
+
+// Sub returns the durations recorded since the prev snapshot.
+func (c *histogramCounts) Sub(prev *histogramCounts) *histogramCounts {
+	var delta histogramCounts
+	for i := range c {
+		delta[i] = c[i] - prev[i]
+	}
+	return &delta
+}
+
+// Quantile returns the middle of the bucket holding the q quantile, 0 when nothing was recorded.
+func (c *histogramCounts) Quantile(q float64) time.Duration {
+	var total uint64
+	for _, count := range c {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	rank = min(max(rank, 1), total)
+	var seen uint64
+	for i, count := range c {
+		seen += count
+		if seen >= rank {
+			low, high := histogramBucketRange(i)
+			return time.Duration(low + (high-low)/2)
+		}
+	}
+	return 0
+}
+
+func histogramBucket(value uint64) int {
+	if value < histogramSubBuckets {
+		return int(value)
+	}
+	shift := bits.Len64(value) - histogramSubBucketBits
+	return shift*histogramHalfBuckets + int(value>>shift)
+}
+
+// histogramBucketRange returns the lowest and highest values of a bucket.
+func histogramBucketRange(bucket int) (low, high uint64) {
+	if bucket < histogramSubBuckets {
+		return uint64(bucket), uint64(bucket)
+	}
+	shift := bucket/histogramHalfBuckets - 1
+	low = uint64(bucket%histogramHalfBuckets+histogramHalfBuckets) << shift
+	return low, low + (1 << shift) - 1
+}
+
+func (p Percentiles) String() string {
+	return fmt.Sprintf("p50=%v p90=%v p99=%v max=%v", p.P50, p.P90, p.P99, p.Max)
+}
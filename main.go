@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"reflect"
+	"time"
 
 	"github.com/go-echarts/go-echarts/v2/charts"
 	"github.com/samber/lo"
@@ -13,18 +17,19 @@ const (
 	benchmarkAverageDataFile  = "docs/benchmarkAverage.json"
 	benchmarkAverageGraphFile = "docs/benchmarkAverage.html"
 	usageGraphFile            = "docs/usage.html"
+	scenariosDataFile         = "docs/scenarios.json"
+	scenariosGraphFile        = "docs/scenarios.html"
+	compareGraphFile          = "docs/compare.html"
+
+	benchmarkAverageAmount  = 3
+	benchmarkMultipleAmount = 5
 )
 
 func main() {
-	// Usage()
-	// Benchmark()
-	LoadBenchmark()
-	// BenchmarkWithAverage()
-	// LoadBenchmarkWithAverage()
-	// BenchmarkMultipleTimes()
+	os.Exit(RunCommand(os.Args[1:]))
 }
 
-func Usage() {
+func Usage(graphFile string) error {
 	graphs := []*charts.Line{
 		goRateLimitUsageOnGraph(),
 		goRateLimitBurstsOnlyOnGraph(),
@@ -32,109 +37,317 @@ func Usage() {
 		imadmonRateLimitUsageOnGraph(),
 	}
 
-	WriteGraphsToFile("Usage echarts", graphs, usageGraphFile)
+	WriteGraphsToFile("Usage echarts", graphs, graphFile)
+	return nil
 }
 
-func Benchmark() {
-	data := RunBenchmark()
-	saveDataToFile(data, benchmarkDataFile)
-	GraphBenchmark(data, benchmarkGraphFile)
+func Benchmark(filter BenchmarkFilter, dataFile, graphFile, benchstatFile string) error {
+	data := RunBenchmark(filter)
+	results := NewBenchmarkResults(data, DefinitionsParameters(data), 1)
+	// the graphs are still rendered when saving the data failed
+	err := saveDataToFile(results, dataFile)
+	saveBenchstatToFile(benchstatFile, results)
+	GraphBenchmark(data, filter, graphFile)
+	return err
 }
 
-func LoadBenchmark() {
-	data, err := loadDataFromFile(benchmarkDataFile)
+func LoadBenchmark(filter BenchmarkFilter, dataFile, graphFile, benchstatFile string) error {
+	data, err := loadDataFromFile(dataFile)
 	if err != nil {
-		return
+		return err
 	}
+	saveBenchstatToFile(benchstatFile, filteredResults(data, filter))
+
+	GraphBenchmark(data.Benchmarks, filter, graphFile)
+	return nil
+}
 
-	GraphBenchmark(data, benchmarkGraphFile)
+func BenchmarkScenarios(scenarios []Scenario, filter BenchmarkFilter, dataFile, graphFile, benchstatFile string) error {
+	data := RunBenchmarkScenarios(scenarios, filter)
+	results := NewBenchmarkResults(data, ScenariosParameters(scenarios, data), 1)
+	err := saveDataToFile(results, dataFile)
+	saveBenchstatToFile(benchstatFile, results)
+	GraphScenarios(scenarios, data, filter, graphFile)
+	return err
 }
 
-func BenchmarkWithAverage() {
-	const benchmarkAmount = 3
-	fmt.Printf("Running benchmark with average of %d iterations\n", benchmarkAmount)
+func LoadBenchmarkScenarios(scenarios []Scenario, filter BenchmarkFilter, dataFile, graphFile, benchstatFile string) error {
+	data, err := loadDataFromFile(dataFile)
+	if err != nil {
+		return err
+	}
+	saveBenchstatToFile(benchstatFile, filteredResults(data, filter))
+
+	GraphScenarios(scenarios, data.Benchmarks, filter, graphFile)
+	return nil
+}
+
+func BenchmarkWithAverage(filter BenchmarkFilter, benchmarkAmount int, dataFile, graphFile, benchstatFile string) error {
+	if benchmarkAmount < 1 {
+		return fmt.Errorf("invalid iterations amount: %d", benchmarkAmount)
+	}
+	fmt.Printf("Running benchmark with %s of %d iterations\n", averageStatistic, benchmarkAmount)
 
 	benchmarkResults := make([]AllBenchmarkData, benchmarkAmount)
 	for i := 0; i < benchmarkAmount; i++ {
 		fmt.Printf("Running Benchmark #%d\n", i+1)
-		benchmarkResults[i] = RunBenchmark()
+		benchmarkResults[i] = RunBenchmark(filter)
 	}
 
 	result := getAllBenchmarkAverage(benchmarkResults)
 	fmt.Printf("Finished running benchmark with average of %d iterations\n", benchmarkAmount)
 
-	saveDataToFile(result, benchmarkAverageDataFile)
-	GraphBenchmark(result, benchmarkAverageGraphFile)
+	results := NewBenchmarkResults(result, DefinitionsParameters(result), benchmarkAmount)
+	err := saveDataToFile(results, dataFile)
+	saveBenchstatToFile(benchstatFile, results)
+	GraphBenchmark(result, filter, graphFile)
+	return err
 }
 
-func LoadBenchmarkWithAverage() {
-	data, err := loadDataFromFile(benchmarkAverageDataFile)
-	if err != nil {
-		return
+// BenchmarkMultipleTimes saves every iteration separately, and all of them together to the benchstat file.
+func BenchmarkMultipleTimes(filter BenchmarkFilter, benchmarkAmount int, dataFile, graphFile, benchstatFile string) error {
+	if benchmarkAmount < 1 {
+		return fmt.Errorf("invalid iterations amount: %d", benchmarkAmount)
 	}
-
-	GraphBenchmark(data, benchmarkAverageGraphFile)
-}
-
-func BenchmarkMultipleTimes() {
-	const benchmarkAmount = 5
 	fmt.Printf("Running benchmark %d times\n", benchmarkAmount)
 
+	iterations := make([]BenchmarkResults, 0, benchmarkAmount)
+	var saveErrs []error
 	for i := 0; i < benchmarkAmount; i++ {
-		data := RunBenchmark()
-		saveDataToFile(data, addNumberToFilename(benchmarkDataFile, i+1))
-		GraphBenchmark(data, addNumberToFilename(benchmarkGraphFile, i+1))
+		data := RunBenchmark(filter)
+		results := NewBenchmarkResults(data, DefinitionsParameters(data), 1)
+		iterations = append(iterations, results)
+		if err := saveDataToFile(results, addNumberToFilename(dataFile, i+1)); err != nil {
+			saveErrs = append(saveErrs, err)
+		}
+		GraphBenchmark(data, filter, addNumberToFilename(graphFile, i+1))
 	}
+	saveBenchstatToFile(benchstatFile, iterations...)
 	fmt.Printf("Finished running benchmark %d times\n", benchmarkAmount)
+	return errors.Join(saveErrs...)
+}
+
+// Compare reports the summary differences of the candidate data file from the baseline one,
+// failing on regressions when failOnRegression is set.
+func Compare(filter BenchmarkFilter, baselineFile, candidateFile string, markdown bool, alpha float64, failOnRegression bool, graphFile string) error {
+	baseline, err := loadDataFromFile(baselineFile)
+	if err != nil {
+		return err
+	}
+	candidate, err := loadDataFromFile(candidateFile)
+	if err != nil {
+		return err
+	}
+
+	for benchmarkType, parameters := range baseline.Parameters {
+		if candidateParameters, ok := candidate.Parameters[benchmarkType]; ok && !reflect.DeepEqual(parameters, candidateParameters) {
+			fmt.Printf("Warning: %s ran with different parameters, %+v instead of %+v\n", benchmarkType, candidateParameters, parameters)
+		}
+	}
+
+	comparisons := CompareResults(baseline, candidate, filter, alpha)
+	if len(comparisons) == 0 {
+		return fmt.Errorf("no reader summaries recorded in both %s and %s", baselineFile, candidateFile)
+	}
+	PrintComparisonReport(os.Stdout, markdown, baseline, candidate, comparisons)
+	GraphComparison(baseline, candidate, comparisons, graphFile)
+
+	if failOnRegression && lo.SomeBy(comparisons, func(c MetricComparison) bool { return c.Verdict == Regressed }) {
+		return errors.New("candidate regressed")
+	}
+	return nil
+}
+
+func filteredResults(results BenchmarkResults, filter BenchmarkFilter) BenchmarkResults {
+	results.Benchmarks = filter.Apply(results.Benchmarks)
+	return results
 }
 
 func getAllBenchmarkAverage(benchmarkResults []AllBenchmarkData) AllBenchmarkData {
 	result := make(AllBenchmarkData)
-	for benchmarkType, _ := range benchmarkResults[0] {
-		result[benchmarkType] = getBenchmarkAverage(benchmarkResults, benchmarkType)
+	for _, benchmarkResult := range benchmarkResults {
+		for benchmarkType := range benchmarkResult {
+			if _, ok := result[benchmarkType]; !ok {
+				result[benchmarkType] = getBenchmarkAverage(benchmarkResults, benchmarkType)
+			}
+		}
 	}
 	return result
 }
 
 func getBenchmarkAverage(benchmarkResults []AllBenchmarkData, benchmarkType BenchmarkType) BenchmarkData {
 	result := make(BenchmarkData)
-	for readerType, _ := range benchmarkResults[0][benchmarkType] {
-		result[readerType] = getBenchmarkReaderAverage(benchmarkResults, benchmarkType, readerType)
+	for _, benchmarkResult := range benchmarkResults {
+		for readerType := range benchmarkResult[benchmarkType] {
+			if _, ok := result[readerType]; !ok {
+				result[readerType] = getBenchmarkReaderAverage(benchmarkResults, benchmarkType, readerType)
+			}
+		}
 	}
 	return result
 }
 
 func getBenchmarkReaderAverage(benchmarkResults []AllBenchmarkData, benchmarkType BenchmarkType, readerType ReaderType) BenchmarkReaderData {
 	result := make(BenchmarkReaderData)
-	for monitorType, seriesData := range benchmarkResults[0][benchmarkType][readerType] {
-		result[monitorType] = SeriesData{
-			Title:  seriesData.Title,
-			Values: getBenchmarkReaderMonitorAverage(benchmarkResults, benchmarkType, readerType, monitorType),
-			Color:  seriesData.Color,
+	for _, benchmarkResult := range benchmarkResults {
+		for monitorType := range benchmarkResult[benchmarkType][readerType] {
+			if _, ok := result[monitorType]; !ok {
+				series := getBenchmarkReaderMonitorAverage(benchmarkResults, benchmarkType, readerType, monitorType)
+				series.Percentiles = getBenchmarkReaderPercentilesAverage(benchmarkResults, benchmarkType, readerType, monitorType)
+				series.Summary = getBenchmarkReaderSummaryAverage(benchmarkResults, benchmarkType, readerType, monitorType)
+				series.Cancellation = getBenchmarkReaderCancellationAverage(benchmarkResults, benchmarkType, readerType, monitorType)
+				series.Fairness = getBenchmarkReaderFairnessAverage(benchmarkResults, benchmarkType, readerType, monitorType)
+				series.Hierarchy = getBenchmarkReaderHierarchyAverage(benchmarkResults, benchmarkType, readerType, monitorType)
+				result[monitorType] = series
+			}
 		}
 	}
 	return result
 }
 
-func getBenchmarkReaderMonitorAverage(benchmarkResults []AllBenchmarkData, benchmarkType BenchmarkType, readerType ReaderType, monitorType MonitorValueType) []int {
-	results := make([][]int, 0)
+// getBenchmarkReaderMonitorAverage aggregates only the iterations that recorded the series,
+// so results with different filters can be averaged together. The iterations are aligned on their test start.
+// Iterations sampled at another interval than the first one are skipped, their values do not line up in time.
+func getBenchmarkReaderMonitorAverage(benchmarkResults []AllBenchmarkData, benchmarkType BenchmarkType, readerType ReaderType, monitorType MonitorValueType) SeriesData {
+	iterations := make([]SeriesData, 0)
+	var interval time.Duration
+	for i, benchmarkResult := range benchmarkResults {
+		seriesData, ok := benchmarkResult[benchmarkType][readerType][monitorType]
+		if !ok {
+			continue
+		}
+		if interval == 0 {
+			interval = seriesData.SampleInterval()
+		}
+		if seriesData.SampleInterval() != interval {
+			fmt.Printf("Skipping iteration #%d of %s %s %s: sampled every %v instead of %v\n",
+				i+1, benchmarkType, readerType, monitorType, seriesData.SampleInterval(), interval)
+			continue
+		}
+		iterations = append(iterations, seriesData)
+	}
+
+	aligned, start := alignedSeries(iterations)
+	bands := aggregateSeries(aligned)
+	return SeriesData{
+		Title:     iterations[0].Title,
+		Values:    bands.Values(averageStatistic),
+		Unit:      iterations[0].Unit,
+		Color:     iterations[0].Color,
+		Interval:  iterations[0].Interval,
+		TestStart: start,
+		Bands:     bands,
+	}
+}
+
+// getBenchmarkReaderPercentilesAverage averages the percentiles of the iterations that recorded them.
+func getBenchmarkReaderPercentilesAverage(benchmarkResults []AllBenchmarkData, benchmarkType BenchmarkType, readerType ReaderType, monitorType MonitorValueType) *Percentiles {
+	var sum Percentiles
+	var amount time.Duration
 	for _, benchmarkResult := range benchmarkResults {
-		results = append(results, benchmarkResult[benchmarkType][readerType][monitorType].Values)
-	}
-
-	seriesAmount := len(results)
-	valuesAmount := len(lo.MinBy(results, func(a, b []int) bool {
-		return len(a) < len(b)
-	}))
-	result := make([]int, valuesAmount)
-	for i := 0; i < valuesAmount; i++ {
-		var sum int
-		for j := 0; j < seriesAmount; j++ {
-			sum += results[j][i]
+		percentiles := benchmarkResult[benchmarkType][readerType][monitorType].Percentiles
+		if percentiles == nil {
+			continue
 		}
+		sum.P50 += percentiles.P50
+		sum.P90 += percentiles.P90
+		sum.P99 += percentiles.P99
+		sum.Max += percentiles.Max
+		amount++
+	}
+	if amount == 0 {
+		return nil
+	}
 
-		result[i] = sum / seriesAmount
+	return &Percentiles{
+		P50: sum.P50 / amount,
+		P90: sum.P90 / amount,
+		P99: sum.P99 / amount,
+		Max: sum.Max / amount,
+	}
+}
+
+// getBenchmarkReaderSummaryAverage averages the summaries of the iterations that recorded them.
+func getBenchmarkReaderSummaryAverage(benchmarkResults []AllBenchmarkData, benchmarkType BenchmarkType, readerType ReaderType, monitorType MonitorValueType) *BenchmarkSummary {
+	var sum BenchmarkSummary
+	var amount float64
+	spikeRecoveries := make([][]SpikeRecovery, 0)
+	limitConvergences := make([][]LimitConvergence, 0)
+	iterations := make([]BenchmarkSummary, 0)
+	for _, benchmarkResult := range benchmarkResults {
+		summary := benchmarkResult[benchmarkType][readerType][monitorType].Summary
+		if summary == nil {
+			continue
+		}
+		iterations = append(iterations, *summary)
+		spikeRecoveries = append(spikeRecoveries, summary.SpikeRecoveries)
+		limitConvergences = append(limitConvergences, summary.LimitConvergences)
+		sum.Throughput += summary.Throughput
+		sum.Limit += summary.Limit
+		sum.ErrorPercent += summary.ErrorPercent
+		sum.CV += summary.CV
+		sum.MaxOvershootPercent += summary.MaxOvershootPercent
+		sum.Elapsed += summary.Elapsed
+		sum.TheoreticalElapsed += summary.TheoreticalElapsed
+		sum.CPUSeconds += summary.CPUSeconds
+		sum.AllocBytes += summary.AllocBytes
+		sum.Allocs += summary.Allocs
+		amount++
+	}
+	if amount == 0 {
+		return nil
+	}
+
+	return &BenchmarkSummary{
+		Throughput:          sum.Throughput / amount,
+		Limit:               sum.Limit / amount,
+		ErrorPercent:        sum.ErrorPercent / amount,
+		CV:                  sum.CV / amount,
+		MaxOvershootPercent: sum.MaxOvershootPercent / amount,
+		Elapsed:             time.Duration(float64(sum.Elapsed) / amount),
+		TheoreticalElapsed:  time.Duration(float64(sum.TheoreticalElapsed) / amount),
+		CPUSeconds:          sum.CPUSeconds / amount,
+		AllocBytes:          sum.AllocBytes / amount,
+		Allocs:              sum.Allocs / amount,
+		SpikeRecoveries:     getSpikeRecoveriesAverage(spikeRecoveries),
+		LimitConvergences:   getLimitConvergencesAverage(limitConvergences),
+		Iterations:          iterations,
+	}
+}
+
+// getSpikeRecoveriesAverage averages every spike over the iterations, a spike counts as settled or drained
+// only when it did in all of them.
+func getSpikeRecoveriesAverage(iterations [][]SpikeRecovery) []SpikeRecovery {
+	spikesAmount := len(lo.MaxBy(iterations, func(a, b []SpikeRecovery) bool { return len(a) > len(b) }))
+	if spikesAmount == 0 {
+		return nil
 	}
 
+	result := make([]SpikeRecovery, spikesAmount)
+	for i := range result {
+		var sum SpikeRecovery
+		var amount float64
+		sum.Settled, sum.Drained = true, true
+		for _, recoveries := range iterations {
+			if i >= len(recoveries) {
+				continue
+			}
+			recovery := recoveries[i]
+			sum.Start, sum.End = recovery.Start, recovery.End
+			sum.PeakRate += recovery.PeakRate
+			sum.Settled = sum.Settled && recovery.Settled
+			sum.SettlingTime += recovery.SettlingTime
+			sum.PeakBacklog += recovery.PeakBacklog
+			sum.Drained = sum.Drained && recovery.Drained
+			sum.BacklogDrainTime += recovery.BacklogDrainTime
+			amount++
+		}
+
+		sum.PeakRate /= amount
+		sum.SettlingTime = time.Duration(float64(sum.SettlingTime) / amount)
+		sum.PeakBacklog /= amount
+		sum.BacklogDrainTime = time.Duration(float64(sum.BacklogDrainTime) / amount)
+		result[i] = sum
+	}
 	return result
 }
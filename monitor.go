@@ -3,46 +3,186 @@ package main
 import (
 	"context"
 	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/metrics"
 	"sync/atomic"
 	"time"
 
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
 )
 
 type MonitorValueType string
 
 var (
 	SyntheticRXBytes atomic.Uint64
+	ConnRXBytes      atomic.Uint64 // bytes read from the benchmark TCP connections, see countingConn
+	ConnTXBytes      atomic.Uint64 // bytes written to the benchmark TCP connections
+	ReadCalls        atomic.Uint64 // Read calls of the benchmarked reader, see instrumentedReadCloser
+	ReadBytes        atomic.Uint64 // bytes returned by the benchmarked reader
+	FirstReadNanos   atomic.Int64  // unix nanoseconds of the benchmarked reader first Read call, 0 before it
+	LastReadNanos    atomic.Int64  // unix nanoseconds of the benchmarked reader last Read return
+	ReadLatencies    durationHistogram
+	ReadGaps         durationHistogram
+	WriteBytes       atomic.Uint64 // bytes accepted by the benchmarked writer, see instrumentedWriteCloser
+	FirstWriteNanos  atomic.Int64  // unix nanoseconds of the benchmarked writer first Write call, 0 before it
+	LastWriteNanos   atomic.Int64  // unix nanoseconds of the benchmarked writer last Write return
+	WriteLatencies   durationHistogram
+	SenderPID        atomic.Int32 // sender process to monitor in split mode, 0 when none
+	PendingTimers    atomic.Int64 // limiter wait timers the adapters started and did not stop yet, see sleepContext
 
-	RX               MonitorValueType = "RX"
+	RX               MonitorValueType = "RX" // bytes received on rxInterface
+	ConnRX           MonitorValueType = "ConnRX"
 	SyntheticRX      MonitorValueType = "SyntheticRX"
 	TotalSyntheticRX MonitorValueType = "TotalSyntheticRX"
-	CPU              MonitorValueType = "CPU"
-	RAM              MonitorValueType = "RAM"
+	CPU              MonitorValueType = "CPU" // this process, percent of a single core
+	RAM              MonitorValueType = "RAM" // this process resident memory
+	GoHeap           MonitorValueType = "GoHeap"
+	SenderCPU        MonitorValueType = "SenderCPU"
+	SenderRAM        MonitorValueType = "SenderRAM"
+	HeapAllocs       MonitorValueType = "HeapAllocs"    // KB allocated during the interval
+	AllocsPerRead    MonitorValueType = "AllocsPerRead" // heap objects allocated per Read call
+	GCCycles         MonitorValueType = "GCCycles"      // GC cycles completed during the interval
+	GCPause          MonitorValueType = "GCPause"       // microseconds the world was stopped for GC during the interval
+	Goroutines       MonitorValueType = "Goroutines"
+	ReadRX           MonitorValueType = "ReadRX"        // bytes returned by the benchmarked reader, summarized by BenchmarkSummary
+	ReadLatency      MonitorValueType = "ReadLatency"   // p99 of the Read calls blocking time during the interval
+	ReadGap          MonitorValueType = "ReadGap"       // p99 of the time between successive Read returns during the interval
+	TX               MonitorValueType = "TX"            // bytes sent on rxInterface
+	ConnTX           MonitorValueType = "ConnTX"        // bytes written to the benchmark TCP connections
+	WriteTX          MonitorValueType = "WriteTX"       // bytes accepted by the benchmarked writer, summarized by BenchmarkSummary
+	WriteLatency     MonitorValueType = "WriteLatency"  // p99 of the Write calls blocking time during the interval
+	CancelLatency    MonitorValueType = "CancelLatency" // cancellation benchmark, Read return after its context was canceled, per attempt
+	CloseLatency     MonitorValueType = "CloseLatency"  // cancellation benchmark, Read return after the reader was closed, per attempt
+
+	TCPMonitorValueTypes     = []MonitorValueType{RX, ConnRX, CPU, RAM, GoHeap, SenderCPU, SenderRAM}
+	RuntimeMonitorValueTypes = []MonitorValueType{HeapAllocs, AllocsPerRead, GCCycles, GCPause, Goroutines}
+	ReadMonitorValueTypes    = []MonitorValueType{ReadRX, ReadLatency, ReadGap}
+	TCPTXMonitorValueTypes   = []MonitorValueType{TX, ConnTX, ConnRX, CPU, RAM, GoHeap}
+	WriteMonitorValueTypes   = []MonitorValueType{WriteTX, WriteLatency}
+
+	// SummaryMonitorValueTypes hold the BenchmarkSummary, the reader output or the writer input of the test
+	SummaryMonitorValueTypes = []MonitorValueType{ReadRX, WriteTX}
+)
+
+// sampling interval of the monitors, below fullMonitorMinInterval only the in-process byte counters are sampled
+var monitorInterval = defaultMonitorInterval
+
+const (
+	defaultMonitorInterval = 200 * time.Millisecond
+	minMonitorInterval     = time.Millisecond
+	fullMonitorMinInterval = 50 * time.Millisecond
+)
+
+// loopback interface counted as RX, the benchmark TCP traffic never leaves the host
+var rxInterface = defaultRXInterface()
+
+const (
+	goHeapMetric       = "/memory/classes/heap/objects:bytes"
+	allocBytesMetric   = "/gc/heap/allocs:bytes"
+	allocObjectsMetric = "/gc/heap/allocs:objects"
+	gcCyclesMetric     = "/gc/cycles/total:gc-cycles"
+	gcPausesMetric     = "/sched/pauses/total/gc:seconds"
+	goroutinesMetric   = "/sched/goroutines:goroutines"
 )
 
 type monitorResult struct {
 	rxDelta          uint64
+	readRXDelta      uint64
+	connRXDelta      uint64
 	syntheticRXDelta uint64
 	totalSyntheticRX uint64
 	cpuPercent       float64
-	ramMB            float64
+	ramBytes         uint64
+	goHeapBytes      uint64
+	senderCPUPercent float64
+	senderRAMBytes   uint64
+	runtimeResult
+	readLatencyP99  time.Duration
+	readGapP99      time.Duration
+	txDelta         uint64
+	connTXDelta     uint64
+	writeTXDelta    uint64
+	writeLatencyP99 time.Duration
+}
+
+type runtimeResult struct {
+	heapAllocBytes uint64
+	allocsPerRead  float64
+	gcCycles       uint64
+	gcPauseSeconds float64
+	goroutines     uint64
+}
+
+// isHighResolutionMonitor reports whether the interval is too short for the system wide monitors,
+// which take about a millisecond per sample.
+func isHighResolutionMonitor() bool {
+	return monitorInterval < fullMonitorMinInterval
+}
+
+// isHighResolutionSampled reports whether the high resolution monitor samples the value type,
+// it records only the counters it can load without a system call.
+func isHighResolutionSampled(valueType MonitorValueType) bool {
+	switch valueType {
+	case ReadRX, WriteTX, SyntheticRX, TotalSyntheticRX, ConnRX, ConnTX:
+		return true
+	}
+	return false
+}
+
+func isSenderMonitor(valueType MonitorValueType) bool {
+	return valueType == SenderCPU || valueType == SenderRAM
 }
 
 func monitorLoop(ctx context.Context, resultsC chan []monitorResult) {
 	SyntheticRXBytes.Store(0) // reset for monitor
-	ticker := time.NewTicker(200 * time.Millisecond)
+	ConnRXBytes.Store(0)
+	ConnTXBytes.Store(0)
+	ReadBytes.Store(0)
+	FirstReadNanos.Store(0)
+	LastReadNanos.Store(0)
+	ReadLatencies.Reset()
+	ReadGaps.Reset()
+	WriteBytes.Store(0)
+	FirstWriteNanos.Store(0)
+	LastWriteNanos.Store(0)
+	WriteLatencies.Reset()
+	ticker := time.NewTicker(monitorInterval)
 	defer ticker.Stop()
+	highResolution := isHighResolutionMonitor()
+	if highResolution {
+		fmt.Printf("High resolution monitor every %v, sampling only ReadRX, WriteTX, SyntheticRX, ConnRX and ConnTX\n", monitorInterval)
+	}
 
-	currRx, err := getRX()
+	// a missing interface is reported once, RX and TX are recorded as 0 while the other monitors keep sampling
+	currRx, currTx, err := getRXTX()
+	rxAvailable := err == nil
+	if !rxAvailable {
+		fmt.Printf("Error reading RX bytes, recording RX and TX as 0: %v\n", err)
+	}
+
+	proc, err := process.NewProcess(int32(os.Getpid()))
 	if err != nil {
-		fmt.Printf("Error reading RX bytes: %v\n", err)
+		fmt.Printf("Error opening process: %v\n", err)
+		resultsC <- nil
+		return
 	}
+	proc.Percent(0) // first call only sets the CPU times baseline
 
+	var sender processMonitor
+	runtimeMon := newRuntimeMonitor()
 	var prevRx uint64 = currRx
+	var prevTx uint64 = currTx
+	var prevConnRx uint64
+	var prevConnTx uint64
 	var prevSyntheticRx uint64
+	var prevReadRx uint64
+	var prevWriteTx uint64
+	prevReadLatencies := ReadLatencies.Snapshot()
+	prevReadGaps := ReadGaps.Snapshot()
+	prevWriteLatencies := WriteLatencies.Snapshot()
 	results := make([]monitorResult, 0)
 
 	for {
@@ -52,51 +192,257 @@ func monitorLoop(ctx context.Context, resultsC chan []monitorResult) {
 			resultsC <- results
 			return
 		case <-ticker.C:
-			currRx, err := getRX()
-			if err != nil {
-				fmt.Printf("Error reading RX bytes: %v\n", err)
-				continue
-			}
-			rxDelta := currRx - prevRx
-			prevRx = currRx
+			currConnRx := ConnRXBytes.Load()
+			connRxDelta := currConnRx - prevConnRx
+			prevConnRx = currConnRx
 
 			currSyntheticRx := SyntheticRXBytes.Load()
 			syntheticRxDelta := currSyntheticRx - prevSyntheticRx
 			prevSyntheticRx = currSyntheticRx
 
-			cpuPercent, err := cpu.Percent(0, false)
-			if err != nil || len(cpuPercent) == 0 {
+			currReadRx := ReadBytes.Load()
+			readRxDelta := currReadRx - prevReadRx
+			prevReadRx = currReadRx
+
+			currConnTx := ConnTXBytes.Load()
+			connTxDelta := currConnTx - prevConnTx
+			prevConnTx = currConnTx
+
+			currWriteTx := WriteBytes.Load()
+			writeTxDelta := currWriteTx - prevWriteTx
+			prevWriteTx = currWriteTx
+
+			if highResolution {
+				results = append(results, monitorResult{
+					readRXDelta:      readRxDelta,
+					connRXDelta:      connRxDelta,
+					syntheticRXDelta: syntheticRxDelta,
+					totalSyntheticRX: currSyntheticRx,
+					connTXDelta:      connTxDelta,
+					writeTXDelta:     writeTxDelta,
+				})
+				continue
+			}
+
+			var rxDelta, txDelta uint64
+			if rxAvailable {
+				currRx, currTx, err := getRXTX()
+				if err != nil {
+					fmt.Printf("Error reading RX bytes: %v\n", err)
+				} else {
+					rxDelta, txDelta = currRx-prevRx, currTx-prevTx
+					prevRx, prevTx = currRx, currTx
+				}
+			}
+
+			cpuPercent, err := proc.Percent(0)
+			if err != nil {
 				fmt.Printf("Error reading CPU usage: %v\n", err)
 				continue
 			}
 
-			vmStat, err := mem.VirtualMemory()
+			memInfo, err := proc.MemoryInfo()
 			if err != nil {
 				fmt.Printf("Error reading memory usage: %v\n", err)
 				continue
 			}
-			ramMB := float64(vmStat.Used) / 1024.0 / 1024.0
+			goHeapBytes, runtimeResult := runtimeMon.sample()
+
+			senderCPUPercent, senderRAMBytes := sender.sample(SenderPID.Load())
+
+			currReadLatencies := ReadLatencies.Snapshot()
+			readLatencyP99 := currReadLatencies.Sub(prevReadLatencies).Quantile(0.99)
+			prevReadLatencies = currReadLatencies
+			currReadGaps := ReadGaps.Snapshot()
+			readGapP99 := currReadGaps.Sub(prevReadGaps).Quantile(0.99)
+			prevReadGaps = currReadGaps
+			currWriteLatencies := WriteLatencies.Snapshot()
+			writeLatencyP99 := currWriteLatencies.Sub(prevWriteLatencies).Quantile(0.99)
+			prevWriteLatencies = currWriteLatencies
 
 			results = append(results, monitorResult{
 				rxDelta:          rxDelta,
+				readRXDelta:      readRxDelta,
+				connRXDelta:      connRxDelta,
 				syntheticRXDelta: syntheticRxDelta,
 				totalSyntheticRX: currSyntheticRx,
-				cpuPercent:       cpuPercent[0],
-				ramMB:            ramMB,
+				cpuPercent:       cpuPercent,
+				ramBytes:         memInfo.RSS,
+				goHeapBytes:      goHeapBytes,
+				senderCPUPercent: senderCPUPercent,
+				senderRAMBytes:   senderRAMBytes,
+				runtimeResult:    runtimeResult,
+				readLatencyP99:   readLatencyP99,
+				readGapP99:       readGapP99,
+				txDelta:          txDelta,
+				connTXDelta:      connTxDelta,
+				writeTXDelta:     writeTxDelta,
+				writeLatencyP99:  writeLatencyP99,
 			})
-			fmt.Printf("RX: %d bytes |CPU: %.2f%% | RAM: %.2fMB | SyntheticRX: %d bytes | TotalSyntheticRX: %d bytes\n",
-				rxDelta, cpuPercent[0], ramMB, syntheticRxDelta, currSyntheticRx)
+			fmt.Printf("RX: %d bytes | ConnRX: %d bytes | CPU: %.2f%% | RAM: %.2fMB | GoHeap: %.2fMB | SyntheticRX: %d bytes | TotalSyntheticRX: %d bytes | Allocs/Read: %.2f | GC: %d | Goroutines: %d\n",
+				rxDelta, connRxDelta, cpuPercent, float64(memInfo.RSS)/mb, float64(goHeapBytes)/mb, syntheticRxDelta, currSyntheticRx,
+				runtimeResult.allocsPerRead, runtimeResult.gcCycles, runtimeResult.goroutines)
+		}
+	}
+}
+
+// runtimeMonitor samples runtime/metrics, turning cumulative metrics into per interval deltas.
+type runtimeMonitor struct {
+	samples          []metrics.Sample
+	prevAllocBytes   uint64
+	prevAllocObjects uint64
+	prevGCCycles     uint64
+	prevGCPause      float64
+	prevReadCalls    uint64
+}
+
+func newRuntimeMonitor() *runtimeMonitor {
+	m := &runtimeMonitor{
+		samples: []metrics.Sample{
+			{Name: goHeapMetric},
+			{Name: allocBytesMetric},
+			{Name: allocObjectsMetric},
+			{Name: gcCyclesMetric},
+			{Name: gcPausesMetric},
+			{Name: goroutinesMetric},
+		},
+	}
+	m.sample() // set the cumulative baselines
+	return m
+}
+
+func (m *runtimeMonitor) sample() (goHeapBytes uint64, result runtimeResult) {
+	metrics.Read(m.samples)
+	goHeapBytes = metricUint64(m.samples[0])
+	allocBytes := metricUint64(m.samples[1])
+	allocObjects := metricUint64(m.samples[2])
+	gcCycles := metricUint64(m.samples[3])
+	gcPause := metricHistogramSum(m.samples[4])
+	readCalls := ReadCalls.Load()
+
+	result = runtimeResult{
+		heapAllocBytes: allocBytes - m.prevAllocBytes,
+		gcCycles:       gcCycles - m.prevGCCycles,
+		gcPauseSeconds: gcPause - m.prevGCPause,
+		goroutines:     metricUint64(m.samples[5]),
+	}
+	if readCallsDelta := readCalls - m.prevReadCalls; readCallsDelta > 0 {
+		result.allocsPerRead = float64(allocObjects-m.prevAllocObjects) / float64(readCallsDelta)
+	}
+
+	m.prevAllocBytes = allocBytes
+	m.prevAllocObjects = allocObjects
+	m.prevGCCycles = gcCycles
+	m.prevGCPause = gcPause
+	m.prevReadCalls = readCalls
+	return goHeapBytes, result
+}
+
+func metricUint64(sample metrics.Sample) uint64 {
+	if sample.Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample.Value.Uint64()
+}
+
+// metricHistogramSum estimates the sum of a histogram metric using the buckets middle values.
+func metricHistogramSum(sample metrics.Sample) float64 {
+	if sample.Value.Kind() != metrics.KindFloat64Histogram {
+		return 0
+	}
+
+	histogram := sample.Value.Float64Histogram()
+	var sum float64
+	for i, count := range histogram.Counts {
+		low, high := histogram.Buckets[i], histogram.Buckets[i+1]
+		if math.IsInf(low, -1) {
+			low = high
+		}
+		if math.IsInf(high, 1) {
+			high = low
 		}
+		sum += float64(count) * (low + high) / 2
 	}
+	return sum
 }
 
-func getRX() (uint64, error) {
-	ioCounters, err := net.IOCounters(false)
-	if err != nil || len(ioCounters) == 0 {
-		return 0, fmt.Errorf("error getting ioCounters: %v", err)
+func processCPUSeconds() float64 {
+	proc, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return 0
+	}
+	times, err := proc.Times()
+	if err != nil {
+		return 0
 	}
-	if len(ioCounters) == 0 {
-		return 0, fmt.Errorf("error got 0 ioCounters")
+	return times.User + times.System
+}
+
+// heapAllocTotals returns the cumulative bytes and objects allocated on the heap by the benchmark process.
+func heapAllocTotals() (bytes, objects uint64) {
+	samples := []metrics.Sample{{Name: allocBytesMetric}, {Name: allocObjectsMetric}}
+	metrics.Read(samples)
+	return metricUint64(samples[0]), metricUint64(samples[1])
+}
+
+// processMonitor samples another process, reopening it whenever the monitored pid changes.
+type processMonitor struct {
+	pid  int32
+	proc *process.Process
+}
+
+func (m *processMonitor) sample(pid int32) (cpuPercent float64, ramBytes uint64) {
+	if pid != m.pid {
+		m.pid = pid
+		m.proc = nil
+		if pid != 0 {
+			proc, err := process.NewProcess(pid)
+			if err != nil {
+				return 0, 0
+			}
+			proc.Percent(0)
+			m.proc = proc
+		}
+	}
+	if m.proc == nil {
+		return 0, 0
+	}
+
+	// the sender may exit between samples, report it as idle
+	cpuPercent, err := m.proc.Percent(0)
+	if err != nil {
+		return 0, 0
+	}
+	memInfo, err := m.proc.MemoryInfo()
+	if err != nil {
+		return cpuPercent, 0
+	}
+	return cpuPercent, memInfo.RSS
+}
+
+// getRXTX returns the bytes received and sent on rxInterface, equal on the loopback interface,
+// or on all the interfaces when rxInterface is empty.
+func getRXTX() (rx, tx uint64, err error) {
+	ioCounters, err := net.IOCounters(rxInterface != "")
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting ioCounters: %v", err)
+	}
+	for _, counters := range ioCounters {
+		if rxInterface == "" || counters.Name == rxInterface {
+			return counters.BytesRecv, counters.BytesSent, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("error interface %q not found", rxInterface)
+}
+
+// defaultRXInterface returns the loopback interface name where it is known, all the interfaces elsewhere.
+func defaultRXInterface() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "lo"
+	case "darwin", "freebsd", "netbsd", "openbsd", "dragonfly":
+		return "lo0"
+	default:
+		return ""
 	}
-	return ioCounters[0].BytesRecv, nil
 }
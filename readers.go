@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"io"
+	"time"
 
 	"github.com/imadmon/limitedreader"
 	jujuratelimit "github.com/juju/ratelimit"
@@ -12,34 +13,129 @@ import (
 
 type ReaderFactory func(reader io.ReadCloser, bufferSize, limit int) io.ReadCloser
 
+// LimitSetter is implemented by the readers whose limit can change mid-stream, SetLimit is called between Reads.
+type LimitSetter interface {
+	SetLimit(limit int)
+}
+
+// ContextReaderFactory returns a reader whose waits return the context error once ctx is done.
+// Closing the reader cancels its context as well, interrupting a blocked Read.
+type ContextReaderFactory func(ctx context.Context, reader io.ReadCloser, bufferSize, limit int) io.ReadCloser
+
+// SharedReaderFactory returns a ReaderFactory whose readers all draw from one limiter, capping their aggregate rate
+// to limit. The buffer size and limit given to the returned factory are ignored.
+type SharedReaderFactory func(bufferSize, limit int) ReaderFactory
+
 type ReaderType string
 
 var (
-	GolangReader  ReaderType = "Golang"
-	JujuReader    ReaderType = "Juju"
-	UberReader    ReaderType = "Uber"
-	IMadmonReader ReaderType = "IMadmon"
+	GolangReader      ReaderType = "Golang"
+	GolangBytesReader ReaderType = "GolangBytes"
+	JujuReader        ReaderType = "Juju"
+	UberReader        ReaderType = "Uber"
+	UberBytesReader   ReaderType = "UberBytes"
+	IMadmonReader     ReaderType = "IMadmon"
 )
 
+// lowRateReadsPerSecond splits the reads of limits below the buffer size, so slow streams trickle instead of
+// stalling for a whole buffer at a time, and the per call limiters get a non zero rate.
+const lowRateReadsPerSecond = 10
+
+// uberBytesTakesPerSecond is the Take rate of the byte accurate Uber adapter, every Take pays for limit/uberBytesTakesPerSecond
+// bytes so the limiter sleeps in millisecond steps whatever the limit.
+const uberBytesTakesPerSecond = 1000
+
+// Example Colors:
+// "#5470c6", "#91cc75", "#fac858", "#ee6666", "#73c0de",
+// "#3ba272", "#fc8452", "#9a60b4", "#ea7ccc",
+func init() {
+	RegisterReader(GolangReader, "#5470c6",
+		"golang.org/x/time/rate bursts limiter, one token per Read call",
+		GolangBurstsRateLimitReaderFactory)
+	RegisterReader(GolangBytesReader, "#91cc75",
+		"golang.org/x/time/rate limiter charged per byte read, WaitN chunked by the burst",
+		GolangBytesRateLimitReaderFactory)
+	RegisterReader(JujuReader, "#ea7ccc",
+		"github.com/juju/ratelimit bursts token bucket, waits for the bytes after each Read",
+		JujuBurstsRateLimitReaderFactory)
+	RegisterReader(UberReader, "#fac858",
+		"go.uber.org/ratelimit deterministic limiter, one Take per Read call",
+		UberDeterministicRateLimitReaderFactory)
+	RegisterReader(UberBytesReader, "#73c0de",
+		"go.uber.org/ratelimit limiter charged per byte read, a Take per limit/1000 bytes",
+		UberBytesRateLimitReaderFactory)
+	RegisterReader(IMadmonReader, "#ee6666",
+		"github.com/imadmon/limitedreader deterministic limited reader",
+		IMadmonDeterministicRateLimitReaderFactory)
+
+	RegisterReaderContextFactory(GolangReader, GolangBurstsRateLimitContextReaderFactory)
+	RegisterReaderContextFactory(GolangBytesReader, GolangBytesRateLimitContextReaderFactory)
+	RegisterReaderContextFactory(JujuReader, JujuBurstsRateLimitContextReaderFactory)
+	RegisterReaderContextFactory(UberReader, UberDeterministicRateLimitContextReaderFactory)
+	RegisterReaderContextFactory(UberBytesReader, UberBytesRateLimitContextReaderFactory)
+
+	// limitedreader has no shared limiter, IMadmon is left out of the shared and hierarchical limit benchmarks
+	RegisterReaderSharedFactory(GolangReader, GolangBurstsRateLimitSharedReaderFactory)
+	RegisterReaderSharedFactory(GolangBytesReader, GolangBytesRateLimitSharedReaderFactory)
+	RegisterReaderSharedFactory(JujuReader, JujuBurstsRateLimitSharedReaderFactory)
+	RegisterReaderSharedFactory(UberReader, UberDeterministicRateLimitSharedReaderFactory)
+	RegisterReaderSharedFactory(UberBytesReader, UberBytesRateLimitSharedReaderFactory)
+}
+
 func IMadmonDeterministicRateLimitReaderFactory(reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
-	return limitedreader.NewLimitedReadCloser(reader, int64(limit))
+	return &IMadmonRateLimitedReader{
+		LimitedReadCloser: limitedreader.NewLimitedReadCloser(reader, int64(limit)),
+		reader:            reader,
+	}
+}
+
+type IMadmonRateLimitedReader struct {
+	*limitedreader.LimitedReadCloser
+	reader io.ReadCloser
+}
+
+// SetLimit replaces the limited reader over the same source.
+func (r *IMadmonRateLimitedReader) SetLimit(limit int) {
+	r.LimitedReadCloser = limitedreader.NewLimitedReadCloser(r.reader, int64(limit))
 }
 
 func GolangBurstsRateLimitReaderFactory(reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+	return GolangBurstsRateLimitContextReaderFactory(context.Background(), reader, bufferSize, limit)
+}
+
+func GolangBurstsRateLimitContextReaderFactory(ctx context.Context, reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+	readSize := lowRateReadSize(bufferSize, limit)
 	// limiter := rate.NewLimiter(rate.Every(time.Second/time.Duration(limit/bufferSize)), 1)
 	// limiter := rate.NewLimiter(rate.Limit(limit/bufferSize), 1)
-	limiter := rate.NewLimiter(rate.Limit(limit/bufferSize), limit/bufferSize)
-	return &GolangRateLimitedReader{
-		reader:  reader,
-		limiter: limiter,
-		ctx:     context.Background(),
+	limiter := rate.NewLimiter(rate.Limit(limit/readSize), limit/readSize)
+	return newGolangRateLimitedReader(ctx, reader, limiter, bufferSize, limit)
+}
+
+func GolangBurstsRateLimitSharedReaderFactory(bufferSize, limit int) ReaderFactory {
+	readSize := lowRateReadSize(bufferSize, limit)
+	limiter := rate.NewLimiter(rate.Limit(limit/readSize), limit/readSize)
+	return func(reader io.ReadCloser, _, _ int) io.ReadCloser {
+		return newGolangRateLimitedReader(context.Background(), reader, limiter, bufferSize, limit)
 	}
 }
 
+func newGolangRateLimitedReader(ctx context.Context, reader io.ReadCloser, limiter *rate.Limiter, bufferSize, limit int) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	return splitReads(&GolangRateLimitedReader{
+		reader:   reader,
+		limiter:  limiter,
+		ctx:      ctx,
+		cancel:   cancel,
+		readSize: lowRateReadSize(bufferSize, limit),
+	}, bufferSize, limit)
+}
+
 type GolangRateLimitedReader struct {
-	reader  io.ReadCloser
-	limiter *rate.Limiter
-	ctx     context.Context
+	reader   io.ReadCloser
+	limiter  *rate.Limiter
+	ctx      context.Context
+	cancel   context.CancelFunc
+	readSize int
 }
 
 func (r *GolangRateLimitedReader) Read(p []byte) (n int, err error) {
@@ -50,51 +146,344 @@ func (r *GolangRateLimitedReader) Read(p []byte) (n int, err error) {
 	return r.reader.Read(p)
 }
 
+// SetLimit keeps the read size of the initial limit, a token still pays for a read.
+// The next reservation caps the saved tokens to the new burst, so lowering the limit takes effect right away.
+func (r *GolangRateLimitedReader) SetLimit(limit int) {
+	r.limiter.SetLimit(rate.Limit(float64(limit) / float64(r.readSize)))
+	r.limiter.SetBurst(max(limit/r.readSize, 1))
+}
+
 func (r *GolangRateLimitedReader) Close() error {
+	r.cancel()
 	return r.reader.Close()
 }
 
-func JujuBurstsRateLimitReaderFactory(reader io.ReadCloser, _, limit int) io.ReadCloser {
+func JujuBurstsRateLimitReaderFactory(reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+	return JujuBurstsRateLimitContextReaderFactory(context.Background(), reader, bufferSize, limit)
+}
+
+// JujuBurstsRateLimitContextReaderFactory takes the tokens without blocking and sleeps the returned wait itself,
+// Bucket.Wait cannot be interrupted.
+func JujuBurstsRateLimitContextReaderFactory(ctx context.Context, reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+	bucket := jujuratelimit.NewBucketWithRate(float64(limit), int64(limit))
+	return newJujuRateLimitedReader(ctx, reader, bucket, bufferSize, limit)
+}
+
+func JujuBurstsRateLimitSharedReaderFactory(bufferSize, limit int) ReaderFactory {
 	bucket := jujuratelimit.NewBucketWithRate(float64(limit), int64(limit))
-	return &JujuRateLimitedReader{
+	return func(reader io.ReadCloser, _, _ int) io.ReadCloser {
+		return newJujuRateLimitedReader(context.Background(), reader, bucket, bufferSize, limit)
+	}
+}
+
+func newJujuRateLimitedReader(ctx context.Context, reader io.ReadCloser, bucket *jujuratelimit.Bucket, bufferSize, limit int) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	return splitReads(&JujuRateLimitedReader{
 		reader: reader,
 		bucket: bucket,
-	}
+		ctx:    ctx,
+		cancel: cancel,
+	}, bufferSize, limit)
 }
 
 type JujuRateLimitedReader struct {
 	reader io.ReadCloser
 	bucket *jujuratelimit.Bucket
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func (r *JujuRateLimitedReader) Read(p []byte) (n int, err error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
 	n, err = r.reader.Read(p)
-	r.bucket.Wait(int64(n))
+	waitErr := sleepContext(r.ctx, r.bucket.Take(int64(n)))
+	if err == nil {
+		err = waitErr
+	}
 	return n, err
 }
 
+// SetLimit replaces the bucket, juju buckets have a fixed rate. The new bucket takes over the tokens of the old one,
+// capped to its capacity, or its debt, so a limit step adds no burst.
+func (r *JujuRateLimitedReader) SetLimit(limit int) {
+	available := r.bucket.Available()
+	bucket := jujuratelimit.NewBucketWithRate(float64(limit), int64(limit))
+	bucket.Take(int64(limit) - min(available, int64(limit)))
+	r.bucket = bucket
+}
+
 func (r *JujuRateLimitedReader) Close() error {
+	r.cancel()
 	return r.reader.Close()
 }
 
 func UberDeterministicRateLimitReaderFactory(reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
-	rl := ratelimit.New(limit / bufferSize) // operations per second
-	return &UberRateLimitedReader{
-		reader:  reader,
-		limiter: rl,
+	return UberDeterministicRateLimitContextReaderFactory(context.Background(), reader, bufferSize, limit)
+}
+
+// UberDeterministicRateLimitContextReaderFactory checks the context around Take, which sleeps uninterrupted.
+func UberDeterministicRateLimitContextReaderFactory(ctx context.Context, reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+	readSize := lowRateReadSize(bufferSize, limit)
+	rl := ratelimit.New(max(limit/readSize, 1)) // operations per second
+	return newUberRateLimitedReader(ctx, reader, rl, bufferSize, limit)
+}
+
+func UberDeterministicRateLimitSharedReaderFactory(bufferSize, limit int) ReaderFactory {
+	rl := ratelimit.New(max(limit/lowRateReadSize(bufferSize, limit), 1)) // operations per second
+	return func(reader io.ReadCloser, _, _ int) io.ReadCloser {
+		return newUberRateLimitedReader(context.Background(), reader, rl, bufferSize, limit)
 	}
 }
 
+func newUberRateLimitedReader(ctx context.Context, reader io.ReadCloser, limiter ratelimit.Limiter, bufferSize, limit int) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	return splitReads(&UberRateLimitedReader{
+		reader:   reader,
+		limiter:  limiter,
+		ctx:      ctx,
+		cancel:   cancel,
+		readSize: lowRateReadSize(bufferSize, limit),
+	}, bufferSize, limit)
+}
+
 type UberRateLimitedReader struct {
-	reader  io.ReadCloser
-	limiter ratelimit.Limiter
+	reader   io.ReadCloser
+	limiter  ratelimit.Limiter
+	ctx      context.Context
+	cancel   context.CancelFunc
+	readSize int
 }
 
 func (r *UberRateLimitedReader) Read(p []byte) (n int, err error) {
-	r.limiter.Take()
+	if err := takeContext(r.ctx, r.limiter); err != nil {
+		return 0, err
+	}
 	return r.reader.Read(p)
 }
 
+// SetLimit replaces the limiter, uber limiters have a fixed rate.
+func (r *UberRateLimitedReader) SetLimit(limit int) {
+	r.limiter = ratelimit.New(max(limit/r.readSize, 1))
+}
+
 func (r *UberRateLimitedReader) Close() error {
+	r.cancel()
 	return r.reader.Close()
 }
+
+// GolangBytesRateLimitReaderFactory charges the limiter for the bytes each Read returned instead of a token per call,
+// so short reads and buffers of any size keep the rate. The burst is a second of data, reads are capped to it.
+func GolangBytesRateLimitReaderFactory(reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+	return GolangBytesRateLimitContextReaderFactory(context.Background(), reader, bufferSize, limit)
+}
+
+func GolangBytesRateLimitContextReaderFactory(ctx context.Context, reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+	limiter := rate.NewLimiter(rate.Limit(limit), max(limit, 1))
+	return newGolangBytesRateLimitedReader(ctx, reader, limiter, bufferSize, limit)
+}
+
+func GolangBytesRateLimitSharedReaderFactory(bufferSize, limit int) ReaderFactory {
+	limiter := rate.NewLimiter(rate.Limit(limit), max(limit, 1))
+	return func(reader io.ReadCloser, _, _ int) io.ReadCloser {
+		return newGolangBytesRateLimitedReader(context.Background(), reader, limiter, bufferSize, limit)
+	}
+}
+
+func newGolangBytesRateLimitedReader(ctx context.Context, reader io.ReadCloser, limiter *rate.Limiter, bufferSize, limit int) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	return splitReads(&GolangBytesRateLimitedReader{
+		reader:  reader,
+		limiter: limiter,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, bufferSize, limit)
+}
+
+type GolangBytesRateLimitedReader struct {
+	reader  io.ReadCloser
+	limiter *rate.Limiter
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func (r *GolangBytesRateLimitedReader) Read(p []byte) (n int, err error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	// WaitN fails for more tokens than the burst, the limiter may be shared and its burst changed by another reader
+	n, err = r.reader.Read(p[:min(len(p), r.limiter.Burst())])
+	if n > 0 {
+		waitErr := r.limiter.WaitN(r.ctx, n)
+		if err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+// SetLimit changes the limiter, the readers sharing it follow its new burst.
+func (r *GolangBytesRateLimitedReader) SetLimit(limit int) {
+	r.limiter.SetLimit(rate.Limit(limit))
+	r.limiter.SetBurst(max(limit, 1))
+}
+
+func (r *GolangBytesRateLimitedReader) Close() error {
+	r.cancel()
+	return r.reader.Close()
+}
+
+// UberBytesRateLimitReaderFactory takes from the limiter for the bytes each Read returned instead of once per call.
+// A Take pays for a fixed amount of bytes, the remainder is carried to the next Read.
+func UberBytesRateLimitReaderFactory(reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+	return UberBytesRateLimitContextReaderFactory(context.Background(), reader, bufferSize, limit)
+}
+
+// UberBytesRateLimitContextReaderFactory checks the context between the Takes, each sleeps a millisecond at most.
+func UberBytesRateLimitContextReaderFactory(ctx context.Context, reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+	limiter := ratelimit.New(max(limit/uberBytesPerTake(limit), 1))
+	return newUberBytesRateLimitedReader(ctx, reader, limiter, bufferSize, limit)
+}
+
+func UberBytesRateLimitSharedReaderFactory(bufferSize, limit int) ReaderFactory {
+	limiter := ratelimit.New(max(limit/uberBytesPerTake(limit), 1))
+	return func(reader io.ReadCloser, _, _ int) io.ReadCloser {
+		return newUberBytesRateLimitedReader(context.Background(), reader, limiter, bufferSize, limit)
+	}
+}
+
+func newUberBytesRateLimitedReader(ctx context.Context, reader io.ReadCloser, limiter ratelimit.Limiter, bufferSize, limit int) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	return splitReads(&UberBytesRateLimitedReader{
+		reader:       reader,
+		limiter:      limiter,
+		ctx:          ctx,
+		cancel:       cancel,
+		bytesPerTake: uberBytesPerTake(limit),
+	}, bufferSize, limit)
+}
+
+func uberBytesPerTake(limit int) int {
+	return max(limit/uberBytesTakesPerSecond, 1)
+}
+
+type UberBytesRateLimitedReader struct {
+	reader       io.ReadCloser
+	limiter      ratelimit.Limiter
+	ctx          context.Context
+	cancel       context.CancelFunc
+	bytesPerTake int
+	unpaid       int // bytes read and not paid for yet
+}
+
+func (r *UberBytesRateLimitedReader) Read(p []byte) (n int, err error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err = r.reader.Read(p)
+	r.unpaid += n
+	for ; r.unpaid >= r.bytesPerTake; r.unpaid -= r.bytesPerTake {
+		if takeErr := takeContext(r.ctx, r.limiter); takeErr != nil {
+			if err == nil {
+				err = takeErr
+			}
+			break
+		}
+	}
+	return n, err
+}
+
+// SetLimit replaces the limiter, the unpaid bytes are paid at the new rate.
+func (r *UberBytesRateLimitedReader) SetLimit(limit int) {
+	r.bytesPerTake = uberBytesPerTake(limit)
+	r.limiter = ratelimit.New(max(limit/r.bytesPerTake, 1))
+}
+
+func (r *UberBytesRateLimitedReader) Close() error {
+	r.cancel()
+	return r.reader.Close()
+}
+
+// lowRateReadSize returns the size the reads are split to, the buffer size unless the limit is below it.
+func lowRateReadSize(bufferSize, limit int) int {
+	if limit >= bufferSize {
+		return bufferSize
+	}
+	return max(limit/lowRateReadsPerSecond, 1)
+}
+
+// splitReads caps the reads of a limited reader to lowRateReadSize when the limit is below the buffer size.
+func splitReads(reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+	readSize := lowRateReadSize(bufferSize, limit)
+	if readSize >= bufferSize {
+		return reader
+	}
+	return &splitReadCloser{ReadCloser: reader, size: readSize}
+}
+
+type splitReadCloser struct {
+	io.ReadCloser
+	size int
+}
+
+func (r *splitReadCloser) Read(p []byte) (n int, err error) {
+	return r.ReadCloser.Read(p[:min(len(p), r.size)])
+}
+
+func (r *splitReadCloser) Unwrap() io.ReadCloser {
+	return r.ReadCloser
+}
+
+// ChainedReaderFactory stacks the readers of connection inside the readers of global, typically the ReaderFactory
+// of a SharedReaderFactory. The limit given to the returned factory is the connection limit.
+func ChainedReaderFactory(connection, global ReaderFactory) ReaderFactory {
+	return func(reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+		return global(connection(reader, bufferSize, limit), bufferSize, limit)
+	}
+}
+
+// SetReaderLimit changes the limit of the reader, unwrapping the benchmark wrappers, and reports whether it supports it.
+// Reads split for a low initial limit keep their size.
+func SetReaderLimit(reader io.Reader, limit int) bool {
+	for {
+		switch r := reader.(type) {
+		case LimitSetter:
+			r.SetLimit(limit)
+			return true
+		case interface{ Unwrap() io.ReadCloser }:
+			reader = r.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// sleepContext sleeps for d, returning early with the context error once ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	PendingTimers.Add(1)
+	defer func() {
+		timer.Stop()
+		PendingTimers.Add(-1)
+	}()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// takeContext takes from the limiter unless ctx is done, Take itself cannot be interrupted so the context error
+// is returned once it slept.
+func takeContext(ctx context.Context, limiter ratelimit.Limiter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	limiter.Take()
+	return ctx.Err()
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	benchmarkBufferSize = 32 * 1024 // 32KB classic io.Copy
+	benchmarkLimit      = 64 * 1024 * 1024
+	overheadLimit       = 1 << 40 // high enough for the limiter never to wait, leaving only its cost
+)
+
+// BenchmarkReaders reads a buffer per op through every registered reader, from the synthetic reader and
+// from a loopback TCP connection, once without waiting to measure the limiter cost and once at a limit
+// to measure its accuracy.
+func BenchmarkReaders(b *testing.B) {
+	sources := []struct {
+		name   string
+		source func(b *testing.B) io.ReadCloser
+	}{
+		{"Synthetic", func(*testing.B) io.ReadCloser { return &syntheticReader{} }},
+		{"TCP", newLoopbackSource},
+	}
+	limits := []struct {
+		name  string
+		limit int
+	}{
+		{"Overhead", overheadLimit},
+		{fmt.Sprintf("Limit%dMB", benchmarkLimit/1024/1024), benchmarkLimit},
+	}
+
+	for _, reader := range RegisteredReaders() {
+		for _, source := range sources {
+			for _, limit := range limits {
+				b.Run(fmt.Sprintf("%s/%s/%s", reader.Type, source.name, limit.name), func(b *testing.B) {
+					benchmarkReader(b, reader.Factory, source.source(b), limit.limit)
+				})
+			}
+		}
+	}
+}
+
+func benchmarkReader(b *testing.B, factory ReaderFactory, source io.ReadCloser, limit int) {
+	counter := &countingReader{ReadCloser: source}
+	reader := factory(counter, benchmarkBufferSize, limit)
+	defer reader.Close()
+	buffer := make([]byte, benchmarkBufferSize)
+
+	if limit != overheadLimit {
+		// drain the initial burst, and what refilled meanwhile, until the Reads wait for the limiter,
+		// so the throughput error measures its steady rate
+		wait := time.Duration(float64(benchmarkBufferSize) / float64(limit) * float64(time.Second) / 2)
+		for drained := 0; drained < 2*limit; drained += benchmarkBufferSize {
+			start := time.Now()
+			if _, err := io.ReadFull(reader, buffer); err != nil {
+				b.Fatalf("drain: %v", err)
+			}
+			if drained >= limit && time.Since(start) >= wait {
+				break
+			}
+		}
+		counter.reads = 0
+	}
+
+	b.SetBytes(benchmarkBufferSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := io.ReadFull(reader, buffer)
+		if err != nil {
+			b.Fatalf("read %d: %v", i, err)
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(counter.reads)/float64(b.N), "source-reads/op")
+	if limit != overheadLimit {
+		throughput := float64(b.N) * benchmarkBufferSize / b.Elapsed().Seconds()
+		b.ReportMetric((throughput-float64(limit))/float64(limit)*100, "throughput-error%")
+	}
+}
+
+// countingReader counts the Read calls reaching the source.
+type countingReader struct {
+	io.ReadCloser
+	reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	return r.ReadCloser.Read(p)
+}
+
+// newLoopbackSource returns the receiving end of a loopback TCP connection the other end writes to
+// until the benchmark ends.
+func newLoopbackSource(b *testing.B) io.ReadCloser {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buffer := make([]byte, benchmarkBufferSize)
+		for {
+			// the write fails once the benchmark closes the receiving end
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if _, err := conn.Write(buffer); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		b.Fatalf("accept: %v", err)
+	}
+	return conn
+}
+
+const (
+	testBufferSize = 32 * 1024
+	testLimit      = 1024 * 1024
+	// testRateTolerance bounds the elapsed time of reading twice the limit, the bursting readers
+	// may read the first second of data at once.
+	testRateTolerance = 0.25
+)
+
+var testSources = []struct {
+	name   string
+	source func(t *testing.T, size int) io.ReadCloser
+}{
+	{"Synthetic", func(_ *testing.T, size int) io.ReadCloser { return &syntheticReader{size: uint64(size)} }},
+	{"Pipe", newPipeSource},
+}
+
+// newPipeSource returns the reading end of a net.Pipe the other end writes size pattern bytes to before closing it.
+func newPipeSource(t *testing.T, size int) io.ReadCloser {
+	reader, writer := net.Pipe()
+	t.Cleanup(func() { reader.Close() })
+	go func() {
+		defer writer.Close()
+		writer.Write(testPattern(size))
+	}()
+	return reader
+}
+
+func testPattern(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+// readAll reads until an error, returning it unlike io.ReadAll which swallows io.EOF.
+func readAll(reader io.Reader, bufferSize int) ([]byte, error) {
+	var data bytes.Buffer
+	buffer := make([]byte, bufferSize)
+	for {
+		n, err := reader.Read(buffer)
+		data.Write(buffer[:n])
+		if err != nil {
+			return data.Bytes(), err
+		}
+	}
+}
+
+// checkRate fails the test unless passing dataSize bytes at limit bytes per second took the expected time,
+// less the first second of data the bursting limiters pass at once.
+func checkRate(t *testing.T, dataSize, limit int, elapsed time.Duration) {
+	t.Helper()
+	minElapsed := time.Duration(float64(dataSize-limit) / float64(limit) * float64(time.Second) * (1 - testRateTolerance))
+	maxElapsed := time.Duration(float64(dataSize) / float64(limit) * float64(time.Second) * (1 + testRateTolerance))
+	if elapsed < minElapsed || elapsed > maxElapsed {
+		t.Fatalf("passed %d bytes at %d bytes/sec in %v, want between %v and %v", dataSize, limit, elapsed, minElapsed, maxElapsed)
+	}
+}
+
+func TestReadersDeliverAllBytes(t *testing.T) {
+	const dataSize = 4*testBufferSize + 123 // the last Read is partial
+
+	for _, reader := range RegisteredReaders() {
+		for _, source := range testSources {
+			t.Run(fmt.Sprintf("%s/%s", reader.Type, source.name), func(t *testing.T) {
+				limitedReader := reader.Factory(source.source(t, dataSize), testBufferSize, overheadLimit)
+				data, err := readAll(limitedReader, testBufferSize)
+				if err != io.EOF {
+					t.Fatalf("got error %v, want io.EOF", err)
+				}
+				if len(data) != dataSize {
+					t.Fatalf("read %d bytes, want %d", len(data), dataSize)
+				}
+				if source.name == "Pipe" && !bytes.Equal(data, testPattern(dataSize)) {
+					t.Fatalf("read data differs from the written data")
+				}
+
+				n, err := limitedReader.Read(make([]byte, testBufferSize))
+				if n != 0 || err != io.EOF {
+					t.Fatalf("Read after EOF returned %d, %v, want 0, io.EOF", n, err)
+				}
+			})
+		}
+	}
+}
+
+func TestReadersHonorLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("reads for seconds")
+	}
+	const dataSize = 2 * testLimit
+
+	for _, reader := range RegisteredReaders() {
+		for _, source := range testSources {
+			t.Run(fmt.Sprintf("%s/%s", reader.Type, source.name), func(t *testing.T) {
+				t.Parallel()
+				limitedReader := reader.Factory(source.source(t, dataSize), testBufferSize, testLimit)
+
+				start := time.Now()
+				data, err := readAll(limitedReader, testBufferSize)
+				elapsed := time.Since(start)
+				if err != io.EOF || len(data) != dataSize {
+					t.Fatalf("read %d bytes with error %v, want %d bytes and io.EOF", len(data), err, dataSize)
+				}
+				checkRate(t, dataSize, testLimit, elapsed)
+			})
+		}
+	}
+}
+
+// TestSharedReadersHonorAggregateLimit reads concurrently through readers sharing a limiter
+// and checks their aggregate rate.
+func TestSharedReadersHonorAggregateLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("reads for seconds")
+	}
+	const connections = 4
+	const dataSize = 2 * testLimit
+
+	for _, reader := range RegisteredReaders() {
+		if reader.SharedFactory == nil {
+			continue
+		}
+		t.Run(string(reader.Type), func(t *testing.T) {
+			t.Parallel()
+			factory := reader.SharedFactory(testBufferSize, testLimit)
+
+			var wg sync.WaitGroup
+			errs := make([]error, connections)
+			start := time.Now()
+			for i := range connections {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					limitedReader := factory(&syntheticReader{size: dataSize / connections}, testBufferSize, testLimit)
+					_, errs[i] = readAll(limitedReader, testBufferSize)
+				}()
+			}
+			wg.Wait()
+			elapsed := time.Since(start)
+
+			for _, err := range errs {
+				if err != io.EOF {
+					t.Fatalf("Read: %v", err)
+				}
+			}
+			checkRate(t, dataSize, testLimit, elapsed)
+		})
+	}
+}
+
+// TestChainedReadersHonorBothLimits stacks the readers of every library inside its shared readers
+// and checks the aggregate rate follows the lower of the connection and global limits.
+func TestChainedReadersHonorBothLimits(t *testing.T) {
+	if testing.Short() {
+		t.Skip("reads for seconds")
+	}
+	const connections = 2
+	limits := []struct {
+		name            string
+		connectionLimit int
+		globalLimit     int
+	}{
+		{"ConnectionBound", testLimit / 4, testLimit},
+		{"GlobalBound", testLimit, testLimit / 2},
+	}
+
+	for _, reader := range RegisteredReaders() {
+		if reader.SharedFactory == nil {
+			continue
+		}
+		for _, limit := range limits {
+			t.Run(fmt.Sprintf("%s/%s", reader.Type, limit.name), func(t *testing.T) {
+				t.Parallel()
+				rate := min(connections*limit.connectionLimit, limit.globalLimit)
+				dataSize := 2 * rate
+				factory := ChainedReaderFactory(reader.Factory, reader.SharedFactory(testBufferSize, limit.globalLimit))
+
+				var wg sync.WaitGroup
+				errs := make([]error, connections)
+				start := time.Now()
+				for i := range connections {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						limitedReader := factory(&syntheticReader{size: uint64(dataSize / connections)}, testBufferSize, limit.connectionLimit)
+						_, errs[i] = readAll(limitedReader, testBufferSize)
+					}()
+				}
+				wg.Wait()
+				elapsed := time.Since(start)
+
+				for _, err := range errs {
+					if err != io.EOF {
+						t.Fatalf("Read: %v", err)
+					}
+				}
+				checkRate(t, dataSize, rate, elapsed)
+			})
+		}
+	}
+}
+
+// TestReadersHonorChangedLimit raises the limit of the readers through the benchmark wrappers
+// and checks the new one is honored.
+func TestReadersHonorChangedLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("reads for seconds")
+	}
+	const dataSize = 2 * testLimit
+
+	for _, reader := range RegisteredReaders() {
+		t.Run(string(reader.Type), func(t *testing.T) {
+			t.Parallel()
+			limitedReader := instrumentedReaderFactory(reader.Factory)(&syntheticReader{}, testBufferSize, testLimit/4)
+			if !SetReaderLimit(limitedReader, testLimit) {
+				t.Fatalf("the reader does not support limit changes")
+			}
+
+			start := time.Now()
+			if _, err := readAll(io.LimitReader(limitedReader, dataSize), testBufferSize); err != io.EOF {
+				t.Fatalf("Read: %v", err)
+			}
+			elapsed := time.Since(start)
+			checkRate(t, dataSize, testLimit, elapsed)
+		})
+	}
+}
+
+// TestReadersHonorLowLimit reads below a buffer per second, where dividing the limit by the buffer size
+// leaves the per call limiters without a rate.
+func TestReadersHonorLowLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("reads for seconds")
+	}
+	const (
+		lowLimit = 1024
+		dataSize = 2 * lowLimit
+	)
+
+	for _, reader := range RegisteredReaders() {
+		t.Run(string(reader.Type), func(t *testing.T) {
+			t.Parallel()
+			limitedReader := reader.Factory(&syntheticReader{size: dataSize}, testBufferSize, lowLimit)
+
+			start := time.Now()
+			data, err := readAll(limitedReader, testBufferSize)
+			elapsed := time.Since(start)
+			if err != io.EOF || len(data) != dataSize {
+				t.Fatalf("read %d bytes with error %v, want %d bytes and io.EOF", len(data), err, dataSize)
+			}
+			checkRate(t, dataSize, lowLimit, elapsed)
+		})
+	}
+}
+
+var errSource = errors.New("source failed")
+
+// failingReader returns its data and then errSource, or errSource along with the last bytes when failWithData is set.
+type failingReader struct {
+	data         []byte
+	failWithData bool
+	closed       bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	if len(r.data) == 0 && (n == 0 || r.failWithData) {
+		return n, errSource
+	}
+	return n, nil
+}
+
+func (r *failingReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestReadersPropagateErrors(t *testing.T) {
+	const dataSize = testBufferSize + 100
+
+	for _, reader := range RegisteredReaders() {
+		for _, failWithData := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/FailWithData=%v", reader.Type, failWithData), func(t *testing.T) {
+				source := &failingReader{data: testPattern(dataSize), failWithData: failWithData}
+				limitedReader := reader.Factory(source, testBufferSize, overheadLimit)
+
+				data, err := readAll(limitedReader, testBufferSize)
+				if !errors.Is(err, errSource) {
+					t.Fatalf("got error %v, want %v", err, errSource)
+				}
+				if !bytes.Equal(data, testPattern(dataSize)) {
+					t.Fatalf("read %d bytes before the error, want the %d source bytes", len(data), dataSize)
+				}
+			})
+		}
+	}
+}
+
+func TestReadersCloseSource(t *testing.T) {
+	for _, reader := range RegisteredReaders() {
+		t.Run(fmt.Sprintf("%s/Memory", reader.Type), func(t *testing.T) {
+			source := &failingReader{data: testPattern(testBufferSize)}
+			err := reader.Factory(source, testBufferSize, overheadLimit).Close()
+			if err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if !source.closed {
+				t.Fatalf("Close did not reach the source")
+			}
+		})
+
+		t.Run(fmt.Sprintf("%s/Pipe", reader.Type), func(t *testing.T) {
+			conn, peer := net.Pipe()
+			defer peer.Close()
+			err := reader.Factory(conn, testBufferSize, overheadLimit).Close()
+			if err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if _, err := peer.Write([]byte("A")); err != io.ErrClosedPipe {
+				t.Fatalf("writing to the closed pipe returned %v, want io.ErrClosedPipe", err)
+			}
+		})
+	}
+}
+
+func TestReadersReturnContextError(t *testing.T) {
+	for _, reader := range RegisteredReaders() {
+		if reader.ContextFactory == nil {
+			continue
+		}
+		t.Run(string(reader.Type), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			source := &countingReader{ReadCloser: &syntheticReader{}}
+			limitedReader := reader.ContextFactory(ctx, source, testBufferSize, testLimit)
+			defer limitedReader.Close()
+
+			if _, err := limitedReader.Read(make([]byte, testBufferSize)); err != nil {
+				t.Fatalf("Read before the cancellation: %v", err)
+			}
+			cancel()
+			n, err := limitedReader.Read(make([]byte, testBufferSize))
+			if n != 0 || !errors.Is(err, context.Canceled) {
+				t.Fatalf("Read after the cancellation returned %d, %v, want 0, context.Canceled", n, err)
+			}
+			if source.reads != 1 {
+				t.Fatalf("the canceled reader read the source %d times, want once", source.reads)
+			}
+		})
+	}
+}
+
+// waitingReader closes waiting on its second Read, the limiters wait for the bytes of the first two after it.
+type waitingReader struct {
+	io.ReadCloser
+	waiting chan struct{}
+	reads   int
+}
+
+func (r *waitingReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.reads == 2 {
+		close(r.waiting)
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// TestReadersCloseInterruptsWait reads a buffer per second, so every Read after the first waits a second,
+// and checks Close interrupts the pending wait.
+func TestReadersCloseInterruptsWait(t *testing.T) {
+	const closeTimeout = 250 * time.Millisecond
+
+	for _, reader := range RegisteredReaders() {
+		if reader.ContextFactory == nil {
+			continue
+		}
+		t.Run(string(reader.Type), func(t *testing.T) {
+			t.Parallel()
+			timeout := closeTimeout
+			if reader.Type == UberReader {
+				timeout += time.Second // Take sleeps uninterrupted, the context is checked after it
+			}
+			source := &waitingReader{ReadCloser: &syntheticReader{}, waiting: make(chan struct{})}
+			limitedReader := reader.ContextFactory(context.Background(), source, testBufferSize, testBufferSize)
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := readAll(limitedReader, testBufferSize)
+				done <- err
+			}()
+			<-source.waiting
+			limitedReader.Close()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("Read after Close returned %v, want context.Canceled", err)
+				}
+			case <-time.After(timeout):
+				t.Fatalf("Read still waiting %v after Close", timeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/samber/lo"
+)
+
+type RegisteredReader struct {
+	Type        ReaderType
+	Color       string
+	Description string
+	Factory     ReaderFactory
+
+	ContextFactory ContextReaderFactory // nil when the reader cannot be interrupted by a context
+	SharedFactory  SharedReaderFactory  // nil when the readers cannot share a limiter
+}
+
+type RegisteredWriter struct {
+	Type        ReaderType
+	Color       string
+	Description string
+	Factory     WriterFactory
+}
+
+var (
+	readersMu sync.RWMutex
+	readers   []RegisteredReader
+	writers   []RegisteredWriter
+)
+
+// RegisterReader makes a ReaderFactory available to every benchmark and graph.
+// Readers are benchmarked and graphed in registration order.
+// It panics if the reader type is empty, already registered or factory is nil.
+func RegisterReader(readerType ReaderType, color, description string, factory ReaderFactory) {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+
+	if readerType == "" {
+		panic("RegisterReader: empty reader type")
+	}
+	if factory == nil {
+		panic(fmt.Sprintf("RegisterReader: nil factory for reader %s", readerType))
+	}
+	for _, reader := range readers {
+		if reader.Type == readerType {
+			panic(fmt.Sprintf("RegisterReader: reader %s registered twice", readerType))
+		}
+	}
+
+	readers = append(readers, RegisteredReader{
+		Type:        readerType,
+		Color:       color,
+		Description: description,
+		Factory:     factory,
+	})
+}
+
+// RegisterReaderContextFactory sets the context aware factory of a registered reader, used by the cancellation benchmark.
+// It panics if the reader is not registered or factory is nil.
+func RegisterReaderContextFactory(readerType ReaderType, factory ContextReaderFactory) {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+
+	if factory == nil {
+		panic(fmt.Sprintf("RegisterReaderContextFactory: nil factory for reader %s", readerType))
+	}
+	for i := range readers {
+		if readers[i].Type == readerType {
+			readers[i].ContextFactory = factory
+			return
+		}
+	}
+	panic(fmt.Sprintf("RegisterReaderContextFactory: reader %s is not registered", readerType))
+}
+
+// RegisterReaderSharedFactory sets the factory of readers sharing a limiter of a registered reader,
+// used by the shared limit benchmark. It panics if the reader is not registered or factory is nil.
+func RegisterReaderSharedFactory(readerType ReaderType, factory SharedReaderFactory) {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+
+	if factory == nil {
+		panic(fmt.Sprintf("RegisterReaderSharedFactory: nil factory for reader %s", readerType))
+	}
+	for i := range readers {
+		if readers[i].Type == readerType {
+			readers[i].SharedFactory = factory
+			return
+		}
+	}
+	panic(fmt.Sprintf("RegisterReaderSharedFactory: reader %s is not registered", readerType))
+}
+
+func RegisteredReaders() []RegisteredReader {
+	readersMu.RLock()
+	defer readersMu.RUnlock()
+
+	return append([]RegisteredReader(nil), readers...)
+}
+
+// RegisterWriter makes a WriterFactory available to the write benchmarks, under the reader type of the same limiter.
+// It panics if the writer type is empty, already registered or factory is nil.
+func RegisterWriter(writerType ReaderType, color, description string, factory WriterFactory) {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+
+	if writerType == "" {
+		panic("RegisterWriter: empty writer type")
+	}
+	if factory == nil {
+		panic(fmt.Sprintf("RegisterWriter: nil factory for writer %s", writerType))
+	}
+	for _, writer := range writers {
+		if writer.Type == writerType {
+			panic(fmt.Sprintf("RegisterWriter: writer %s registered twice", writerType))
+		}
+	}
+
+	writers = append(writers, RegisteredWriter{
+		Type:        writerType,
+		Color:       color,
+		Description: description,
+		Factory:     factory,
+	})
+}
+
+func RegisteredWriters() []RegisteredWriter {
+	readersMu.RLock()
+	defer readersMu.RUnlock()
+
+	return append([]RegisteredWriter(nil), writers...)
+}
+
+// selectedWriters returns the registered writers of the selected readers types, in registration order.
+func selectedWriters(selected []RegisteredReader) []RegisteredWriter {
+	return lo.Filter(RegisteredWriters(), func(writer RegisteredWriter, _ int) bool {
+		return lo.ContainsBy(selected, func(reader RegisteredReader) bool { return reader.Type == writer.Type })
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// BenchmarkResultsVersion is the current data file schema version, bump it on incompatible changes
+// and migrate the older versions in migrateBenchmarkResults.
+// Version 2 stores the raw sample values with their unit, version 1 and unversioned files stored display unit integers.
+const BenchmarkResultsVersion = 2
+
+// BenchmarkResults is the saved data file, the benchmarks data wrapped with how it was produced.
+// Files saved before the schema was versioned hold only the Benchmarks map and are loaded with a nil Metadata.
+type BenchmarkResults struct {
+	Version    int                                   `json:"version"`
+	Metadata   *RunMetadata                          `json:"metadata,omitempty"`
+	Parameters map[BenchmarkType]BenchmarkParameters `json:"parameters,omitempty"`
+	Benchmarks AllBenchmarkData                      `json:"benchmarks"`
+}
+
+type RunMetadata struct {
+	Timestamp       time.Time         `json:"timestamp"`
+	Hostname        string            `json:"hostname"`
+	OS              string            `json:"os"`
+	Arch            string            `json:"arch"`
+	Kernel          string            `json:"kernel,omitempty"`
+	CPUModel        string            `json:"cpuModel,omitempty"`
+	Cores           int               `json:"cores"`
+	GoVersion       string            `json:"goVersion"`
+	Modules         map[string]string `json:"modules,omitempty"`   // module path to version, including the limiter libraries
+	Iterations      int               `json:"iterations"`          // runs averaged into the data
+	Statistic       AverageStatistic  `json:"statistic,omitempty"` // per sample statistic of averaged data
+	MonitorInterval Duration          `json:"monitorInterval"`
+	SplitSender     bool              `json:"splitSender"`
+	RXInterface     string            `json:"rxInterface"`
+}
+
+func NewBenchmarkResults(data AllBenchmarkData, parameters map[BenchmarkType]BenchmarkParameters, iterations int) BenchmarkResults {
+	return BenchmarkResults{
+		Version:    BenchmarkResultsVersion,
+		Metadata:   newRunMetadata(iterations),
+		Parameters: parameters,
+		Benchmarks: data,
+	}
+}
+
+func newRunMetadata(iterations int) *RunMetadata {
+	metadata := &RunMetadata{
+		Timestamp:       time.Now().UTC(),
+		OS:              runtime.GOOS,
+		Arch:            runtime.GOARCH,
+		Cores:           runtime.NumCPU(),
+		GoVersion:       runtime.Version(),
+		Modules:         make(map[string]string),
+		Iterations:      iterations,
+		MonitorInterval: Duration(monitorInterval),
+		SplitSender:     splitSender,
+		RXInterface:     rxInterface,
+	}
+
+	// best effort, the data is still useful without the host details
+	metadata.Hostname, _ = os.Hostname()
+	metadata.Kernel, _ = host.KernelVersion()
+	if cpuInfo, err := cpu.Info(); err == nil && len(cpuInfo) > 0 {
+		metadata.CPUModel = cpuInfo[0].ModelName
+	}
+	if iterations > 1 {
+		metadata.Statistic = averageStatistic
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, module := range buildInfo.Deps {
+			version := module.Version
+			if module.Replace != nil {
+				version = fmt.Sprintf("%s => %s %s", version, module.Replace.Path, module.Replace.Version)
+			}
+			metadata.Modules[module.Path] = version
+		}
+	}
+
+	return metadata
+}
+
+// DefinitionsParameters returns the parameters of the benchmark definitions present in data.
+func DefinitionsParameters(data AllBenchmarkData) map[BenchmarkType]BenchmarkParameters {
+	parameters := make(map[BenchmarkType]BenchmarkParameters)
+	for _, definition := range BenchmarkDefinitions {
+		if _, ok := data[definition.Type]; ok {
+			parameters[definition.Type] = definition.Parameters
+		}
+	}
+	return parameters
+}
+
+// ScenariosParameters returns the parameters of the scenarios present in data.
+func ScenariosParameters(scenarios []Scenario, data AllBenchmarkData) map[BenchmarkType]BenchmarkParameters {
+	parameters := make(map[BenchmarkType]BenchmarkParameters)
+	for _, scenario := range scenarios {
+		if _, ok := data[BenchmarkType(scenario.Name)]; ok {
+			parameters[BenchmarkType(scenario.Name)] = scenario.Parameters()
+		}
+	}
+	return parameters
+}
+
+// migrateBenchmarkResults decodes any data file version into the current schema.
+func migrateBenchmarkResults(raw []byte) (BenchmarkResults, error) {
+	var header struct {
+		Version *int `json:"version"`
+	}
+	err := json.Unmarshal(raw, &header)
+	if err != nil {
+		return BenchmarkResults{}, err
+	}
+
+	if header.Version == nil {
+		// unversioned files are the bare benchmarks map
+		var data AllBenchmarkData
+		err = json.Unmarshal(raw, &data)
+		if err != nil {
+			return BenchmarkResults{}, err
+		}
+		migrateDisplayValues(data)
+		return BenchmarkResults{Version: BenchmarkResultsVersion, Benchmarks: data}, nil
+	}
+
+	if *header.Version > BenchmarkResultsVersion {
+		return BenchmarkResults{}, fmt.Errorf("unsupported data version %d, newest supported is %d", *header.Version, BenchmarkResultsVersion)
+	}
+
+	var results BenchmarkResults
+	err = json.Unmarshal(raw, &results)
+	if err != nil {
+		return BenchmarkResults{}, err
+	}
+	if results.Version < 2 {
+		migrateDisplayValues(results.Benchmarks)
+	}
+	results.Version = BenchmarkResultsVersion
+	return results, nil
+}
+
+// migrateDisplayValues converts the series saved in their display units back to raw values.
+// The values were truncated when saved, so small samples stay zero.
+func migrateDisplayValues(data AllBenchmarkData) {
+	for _, benchmarkData := range data {
+		for _, readerData := range benchmarkData {
+			for monitorType, series := range readerData {
+				scale := monitorDisplayScale(monitorType)
+				for i := range series.Values {
+					series.Values[i] *= scale
+				}
+				series.Unit = monitorUnits[monitorType]
+				readerData[monitorType] = series
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMigrateBenchmarkResults(t *testing.T) {
+	const (
+		benchmarkType = BenchmarkType("BenchmarkLimitStepsRealWorldLocal")
+		readerType    = ReaderType("Golang")
+	)
+
+	// the older versions saved the values in the display units: MB, KB for HeapAllocs, microseconds
+	displayBenchmarks := `{"BenchmarkLimitStepsRealWorldLocal": {"Golang": {
+		"ReadRX": {"Title": "Golang", "Values": [1, 2], "Color": "#5470c6"},
+		"HeapAllocs": {"Title": "Golang", "Values": [3], "Color": "#5470c6"},
+		"ReadLatency": {"Title": "Golang", "Values": [250], "Color": "#5470c6"},
+		"CPU": {"Title": "Golang", "Values": [50], "Color": "#5470c6"}
+	}}}`
+	migratedValues := map[MonitorValueType][]float64{
+		ReadRX:      {mb, 2 * mb},
+		HeapAllocs:  {3 * kb},
+		ReadLatency: {250e-6},
+		CPU:         {50},
+	}
+
+	tests := []struct {
+		name         string
+		raw          string
+		wantValues   map[MonitorValueType][]float64
+		wantHostname string // empty for a nil Metadata
+	}{
+		{
+			name:       "Unversioned",
+			raw:        displayBenchmarks,
+			wantValues: migratedValues,
+		},
+		{
+			name:         "Version1",
+			raw:          `{"version": 1, "metadata": {"hostname": "bench"}, "benchmarks": ` + displayBenchmarks + `}`,
+			wantValues:   migratedValues,
+			wantHostname: "bench",
+		},
+		{
+			name: "Version2",
+			raw: `{"version": 2, "metadata": {"hostname": "bench"}, "benchmarks": {"BenchmarkLimitStepsRealWorldLocal": {"Golang": {
+				"ReadRX": {"Title": "Golang", "Values": [1048576, 2097152], "Unit": "bytes", "Color": "#5470c6"},
+				"HeapAllocs": {"Title": "Golang", "Values": [3072], "Unit": "bytes", "Color": "#5470c6"},
+				"ReadLatency": {"Title": "Golang", "Values": [0.00025], "Unit": "seconds", "Color": "#5470c6"},
+				"CPU": {"Title": "Golang", "Values": [50], "Unit": "percent", "Color": "#5470c6"}
+			}}}}`,
+			wantValues:   migratedValues,
+			wantHostname: "bench",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := migrateBenchmarkResults([]byte(test.raw))
+			if err != nil {
+				t.Fatalf("migrateBenchmarkResults: %v", err)
+			}
+			if results.Version != BenchmarkResultsVersion {
+				t.Fatalf("got version %d, want %d", results.Version, BenchmarkResultsVersion)
+			}
+			var hostname string
+			if results.Metadata != nil {
+				hostname = results.Metadata.Hostname
+			}
+			if hostname != test.wantHostname {
+				t.Fatalf("got hostname %q, want %q", hostname, test.wantHostname)
+			}
+
+			readerData := results.Benchmarks[benchmarkType][readerType]
+			if len(readerData) != len(test.wantValues) {
+				t.Fatalf("got %d series, want %d", len(readerData), len(test.wantValues))
+			}
+			for monitorType, wantValues := range test.wantValues {
+				series := readerData[monitorType]
+				if !slices.Equal(series.Values, wantValues) {
+					t.Errorf("%s values are %v, want %v", monitorType, series.Values, wantValues)
+				}
+				if series.Unit != monitorUnits[monitorType] {
+					t.Errorf("%s unit is %q, want %q", monitorType, series.Unit, monitorUnits[monitorType])
+				}
+				if series.Title != string(readerType) || series.Color != "#5470c6" {
+					t.Errorf("%s lost its title or color: %q, %q", monitorType, series.Title, series.Color)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateBenchmarkResultsRejectsNewerVersions(t *testing.T) {
+	_, err := migrateBenchmarkResults([]byte(`{"version": 3, "benchmarks": {}}`))
+	if err == nil {
+		t.Fatalf("migrateBenchmarkResults accepted a version newer than %d", BenchmarkResultsVersion)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"path/filepath"
 	"reflect"
 	"runtime"
@@ -10,43 +11,86 @@ import (
 	"time"
 )
 
-// Example Colors:
-// "#5470c6", "#91cc75", "#fac858", "#ee6666", "#73c0de",
-// "#3ba272", "#fc8452", "#9a60b4", "#ea7ccc",
-const (
-	GolangSeriesName   = "Golang"
-	GolangSeriesColor  = "#5470c6"
-	JujuSeriesName     = "Juju"
-	JujuSeriesColor    = "#ea7ccc"
-	UberSeriesName     = "Uber"
-	UberSeriesColor    = "#fac858"
-	IMadmonSeriesName  = "IMadmon"
-	IMadmonSeriesColor = "#ee6666"
-)
+func RunTestWithMonitor(testFn BenchmarkTest, factory ReaderFactory, parameters BenchmarkParameters,
+	seriesName, color string, seriesValueTypes []MonitorValueType) BenchmarkReaderData {
+	return runWithMonitor(func() { RunTest(testFn, factory) }, ReadRX, parameters, seriesName, color, seriesValueTypes)
+}
 
-func RunTestWithMonitor(testFn BenchmarkTest, factory ReaderFactory,
+func RunWriterTestWithMonitor(testFn WriterBenchmarkTest, factory WriterFactory, parameters BenchmarkParameters,
+	seriesName, color string, seriesValueTypes []MonitorValueType) BenchmarkReaderData {
+	return runWithMonitor(func() { RunWriterTest(testFn, factory) }, WriteTX, parameters, seriesName, color, seriesValueTypes)
+}
+
+// runWithMonitor runs the test between idle monitored intervals, summarizing the bytes of summaryMonitor,
+// ReadRX for reader tests and WriteTX for writer tests.
+func runWithMonitor(run func(), summaryMonitor MonitorValueType, parameters BenchmarkParameters,
 	seriesName, color string, seriesValueTypes []MonitorValueType) BenchmarkReaderData {
 
 	ctx, ctxCancel := context.WithCancel(context.Background())
 	resultsC := make(chan []monitorResult)
 
+	monitorStart := time.Now()
 	go monitorLoop(ctx, resultsC)
 	time.Sleep(300 * time.Millisecond)
 
-	RunTest(testFn, factory)
+	cpuSeconds := processCPUSeconds()
+	allocBytes, allocObjects := heapAllocTotals()
+	testStart := time.Since(monitorStart)
+	run()
+	currAllocBytes, currAllocObjects := heapAllocTotals()
+	cpuSeconds = processCPUSeconds() - cpuSeconds
 
 	time.Sleep(700 * time.Millisecond)
 	ctxCancel()
 	time.Sleep(300 * time.Millisecond)
 
 	results := <-resultsC
+	percentiles := map[MonitorValueType]Percentiles{
+		ReadLatency:  ReadLatencies.Percentiles(),
+		ReadGap:      ReadGaps.Percentiles(),
+		WriteLatency: WriteLatencies.Percentiles(),
+	}
+	totalBytes, firstCall, lastReturn := ReadBytes.Load(), FirstReadNanos.Load(), LastReadNanos.Load()
+	if summaryMonitor == WriteTX {
+		totalBytes, firstCall, lastReturn = WriteBytes.Load(), FirstWriteNanos.Load(), LastWriteNanos.Load()
+		fmt.Printf("%s Write latency: %v\n", seriesName, percentiles[WriteLatency])
+	} else {
+		fmt.Printf("%s Read latency: %v | Read gap: %v\n", seriesName, percentiles[ReadLatency], percentiles[ReadGap])
+	}
+	elapsed := time.Duration(lastReturn - firstCall)
+	if firstCall != 0 {
+		// the first Read or Write call marks the test start, readers and writers may set up before it
+		testStart = time.Unix(0, firstCall).Sub(monitorStart)
+	}
+	summary := NewBenchmarkSummary(results, summaryMonitor, parameters, totalBytes, elapsed, cpuSeconds)
+	summary.AllocBytes = float64(currAllocBytes - allocBytes)
+	summary.Allocs = float64(currAllocObjects - allocObjects)
+
 	seriesData := make(BenchmarkReaderData)
 	for _, seriesValueType := range seriesValueTypes {
+		if isSenderMonitor(seriesValueType) && !splitSender {
+			continue
+		}
+		if isHighResolutionMonitor() && !isHighResolutionSampled(seriesValueType) {
+			continue
+		}
 		seriesData[seriesValueType] = SeriesData{
-			Title:  seriesName,
-			Values: parseGraphValue(results, seriesValueType),
-			Color:  color,
+			Title:    seriesName,
+			Values:   parseGraphValue(results, seriesValueType),
+			Unit:     monitorUnits[seriesValueType],
+			Color:    color,
+			Interval: monitorInterval,
+
+			TestStart: testStart,
+		}
+		series := seriesData[seriesValueType]
+		if p, ok := percentiles[seriesValueType]; ok {
+			series.Percentiles = &p
 		}
+		if seriesValueType == summaryMonitor {
+			series.Summary = summary
+		}
+		seriesData[seriesValueType] = series
 	}
 
 	return seriesData
@@ -56,48 +100,112 @@ func RunTest(testFn BenchmarkTest, factory ReaderFactory) {
 	testName := strings.TrimPrefix(filepath.Ext(runtime.FuncForPC(reflect.ValueOf(testFn).Pointer()).Name()), ".")
 	factoryName := strings.TrimPrefix(filepath.Ext(runtime.FuncForPC(reflect.ValueOf(factory).Pointer()).Name()), ".")
 	fmt.Printf("Starting %s using %s...\n", testName, factoryName)
-	testFn(factory)
+	testFn(instrumentedReaderFactory(factory))
 	time.Sleep(250 * time.Millisecond)
 	fmt.Printf("Finished %s using %s\n", testName, factoryName)
 	time.Sleep(250 * time.Millisecond)
 }
 
-func RunGolangTest(testFn BenchmarkTest, seriesValueTypes []MonitorValueType) BenchmarkReaderData {
-	return RunTestWithMonitor(
-		testFn,
-		GolangBurstsRateLimitReaderFactory,
-		GolangSeriesName,
-		GolangSeriesColor,
-		seriesValueTypes,
-	)
+// WriterBenchmarkTest writes through the limited writers the factory returns.
+type WriterBenchmarkTest func(WriterFactory)
+
+func RunWriterTest(testFn WriterBenchmarkTest, factory WriterFactory) {
+	testName := strings.TrimPrefix(filepath.Ext(runtime.FuncForPC(reflect.ValueOf(testFn).Pointer()).Name()), ".")
+	factoryName := strings.TrimPrefix(filepath.Ext(runtime.FuncForPC(reflect.ValueOf(factory).Pointer()).Name()), ".")
+	fmt.Printf("Starting %s using %s...\n", testName, factoryName)
+	testFn(instrumentedWriterFactory(factory))
+	time.Sleep(250 * time.Millisecond)
+	fmt.Printf("Finished %s using %s\n", testName, factoryName)
+	time.Sleep(250 * time.Millisecond)
 }
 
-func RunJujuTest(testFn BenchmarkTest, seriesValueTypes []MonitorValueType) BenchmarkReaderData {
-	return RunTestWithMonitor(
-		testFn,
-		JujuBurstsRateLimitReaderFactory,
-		JujuSeriesName,
-		JujuSeriesColor,
-		seriesValueTypes,
-	)
+func RunWritersTest(writers []RegisteredWriter, testFn WriterBenchmarkTest, parameters BenchmarkParameters, seriesValueTypes []MonitorValueType) BenchmarkData {
+	result := make(BenchmarkData)
+	for _, writer := range writers {
+		result[writer.Type] = RunWriterTestWithMonitor(
+			testFn,
+			writer.Factory,
+			parameters,
+			string(writer.Type),
+			writer.Color,
+			seriesValueTypes,
+		)
+	}
+	return result
 }
 
-func RunUberTest(testFn BenchmarkTest, seriesValueTypes []MonitorValueType) BenchmarkReaderData {
-	return RunTestWithMonitor(
-		testFn,
-		UberDeterministicRateLimitReaderFactory,
-		UberSeriesName,
-		UberSeriesColor,
-		seriesValueTypes,
-	)
+func RunReadersTest(readers []RegisteredReader, testFn BenchmarkTest, parameters BenchmarkParameters, seriesValueTypes []MonitorValueType) BenchmarkData {
+	result := make(BenchmarkData)
+	for _, reader := range readers {
+		result[reader.Type] = RunReaderTest(reader, testFn, parameters, seriesValueTypes)
+	}
+	return result
 }
 
-func RunIMadmonTest(testFn BenchmarkTest, seriesValueTypes []MonitorValueType) BenchmarkReaderData {
+func RunReaderTest(reader RegisteredReader, testFn BenchmarkTest, parameters BenchmarkParameters, seriesValueTypes []MonitorValueType) BenchmarkReaderData {
 	return RunTestWithMonitor(
 		testFn,
-		IMadmonDeterministicRateLimitReaderFactory,
-		IMadmonSeriesName,
-		IMadmonSeriesColor,
+		reader.Factory,
+		parameters,
+		string(reader.Type),
+		reader.Color,
 		seriesValueTypes,
 	)
 }
+
+func instrumentedReaderFactory(factory ReaderFactory) ReaderFactory {
+	return func(reader io.ReadCloser, bufferSize, limit int) io.ReadCloser {
+		return &instrumentedReadCloser{ReadCloser: factory(reader, bufferSize, limit)}
+	}
+}
+
+// instrumentedReadCloser counts the Read calls of the benchmarked reader and records how long each call
+// blocked and the gap between successive returns.
+type instrumentedReadCloser struct {
+	io.ReadCloser
+	lastReturn time.Time
+}
+
+func (r *instrumentedReadCloser) Unwrap() io.ReadCloser {
+	return r.ReadCloser
+}
+
+func (r *instrumentedReadCloser) Read(p []byte) (n int, err error) {
+	ReadCalls.Add(1)
+	start := time.Now()
+	FirstReadNanos.CompareAndSwap(0, start.UnixNano())
+	n, err = r.ReadCloser.Read(p)
+	end := time.Now()
+	ReadBytes.Add(uint64(n))
+	LastReadNanos.Store(end.UnixNano())
+
+	ReadLatencies.Record(end.Sub(start))
+	if !r.lastReturn.IsZero() {
+		ReadGaps.Record(end.Sub(r.lastReturn))
+	}
+	r.lastReturn = end
+	return n, err
+}
+
+func instrumentedWriterFactory(factory WriterFactory) WriterFactory {
+	return func(writer io.WriteCloser, bufferSize, limit int) io.WriteCloser {
+		return &instrumentedWriteCloser{WriteCloser: factory(writer, bufferSize, limit)}
+	}
+}
+
+// instrumentedWriteCloser records the bytes the benchmarked writer accepted and how long each Write call blocked.
+type instrumentedWriteCloser struct {
+	io.WriteCloser
+}
+
+func (w *instrumentedWriteCloser) Write(p []byte) (n int, err error) {
+	start := time.Now()
+	FirstWriteNanos.CompareAndSwap(0, start.UnixNano())
+	n, err = w.WriteCloser.Write(p)
+	end := time.Now()
+	WriteBytes.Add(uint64(n))
+	LastWriteNanos.Store(end.UnixNano())
+
+	WriteLatencies.Record(end.Sub(start))
+	return n, err
+}
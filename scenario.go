@@ -0,0 +1,445 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+type SourceKind string
+
+var (
+	SyntheticSource SourceKind = "synthetic"
+	TCPSource       SourceKind = "tcp"
+)
+
+type TrafficKind string
+
+var (
+	BulkTraffic  TrafficKind = "bulk"
+	PacedTraffic TrafficKind = "paced"
+)
+
+const defaultChunkInterval = 50 * time.Millisecond
+
+// Scenario describes a single benchmark test, for example:
+//
+//	{
+//	  "name": "UploadSpike",
+//	  "source": "tcp",
+//	  "dataSize": "100MB",
+//	  "bufferSize": "32KB",
+//	  "limit": "15MB",
+//	  "traffic": {
+//	    "kind": "paced",
+//	    "spikes": [{"start": "1s", "end": "3s", "multiplier": 3}]
+//	  }
+//	}
+type Scenario struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Source      SourceKind         `json:"source"`
+	DataSize    ByteSize           `json:"dataSize,omitempty"` // 0 means endless, synthetic source only
+	BufferSize  ByteSize           `json:"bufferSize"`
+	Limit       ByteSize           `json:"limit,omitempty"`    // bytes per second, 0 means unlimited
+	Duration    Duration           `json:"duration,omitempty"` // stop reading after duration, 0 means until EOF
+	Traffic     TrafficShape       `json:"traffic,omitempty"`
+	LimitSteps  []LimitStep        `json:"limitSteps,omitempty"` // limit changes during the read, see LimitSetter
+	Monitors    []MonitorValueType `json:"monitors,omitempty"`
+}
+
+// LimitStep changes the reader limit at a time from the first Read.
+type LimitStep struct {
+	At    Duration `json:"at"`
+	Limit ByteSize `json:"limit"`
+}
+
+type TrafficShape struct {
+	Kind          TrafficKind    `json:"kind,omitempty"`
+	Rate          ByteSize       `json:"rate,omitempty"`          // bytes per second sent, defaults to the scenario limit
+	ChunkInterval Duration       `json:"chunkInterval,omitempty"` // defaults to 50ms
+	Spikes        []TrafficSpike `json:"spikes,omitempty"`
+}
+
+type TrafficSpike struct {
+	Start      Duration `json:"start"`
+	End        Duration `json:"end"`
+	Multiplier float64  `json:"multiplier"`
+}
+
+// LoadScenariosFromFile loads a JSON scenario file, or a YAML one by its .yaml or .yml extension.
+func LoadScenariosFromFile(filename string) ([]Scenario, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		data, err = yamlToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse scenario file %s: %w", filename, err)
+		}
+	}
+
+	var scenarios []Scenario
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err = json.Unmarshal(data, &scenarios)
+	} else {
+		var scenario Scenario
+		err = json.Unmarshal(data, &scenario)
+		scenarios = append(scenarios, scenario)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse scenario file %s: %w", filename, err)
+	}
+
+	for i := range scenarios {
+		err = scenarios[i].normalize()
+		if err != nil {
+			return nil, fmt.Errorf("invalid scenario #%d in %s: %w", i+1, filename, err)
+		}
+	}
+
+	return scenarios, nil
+}
+
+// yamlToJSON converts a YAML document to JSON, the scenario fields then parse the same in both formats.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var document any
+	err := yaml.Unmarshal(data, &document)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+func (s *Scenario) normalize() error {
+	if s.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if s.BufferSize <= 0 {
+		return fmt.Errorf("%s: bufferSize must be positive", s.Name)
+	}
+	if s.DataSize < 0 || s.Limit < 0 || s.Duration < 0 {
+		return fmt.Errorf("%s: dataSize, limit and duration can not be negative", s.Name)
+	}
+	if s.Traffic.Kind == "" {
+		s.Traffic.Kind = BulkTraffic
+	}
+	if s.Traffic.ChunkInterval == 0 {
+		s.Traffic.ChunkInterval = Duration(defaultChunkInterval)
+	}
+	if s.Traffic.Rate == 0 {
+		s.Traffic.Rate = s.Limit
+	}
+
+	switch s.Source {
+	case SyntheticSource:
+		if s.DataSize == 0 && s.Duration == 0 {
+			return fmt.Errorf("%s: endless synthetic source requires a duration", s.Name)
+		}
+		if s.Traffic.Kind != BulkTraffic {
+			return fmt.Errorf("%s: synthetic source supports only %s traffic", s.Name, BulkTraffic)
+		}
+		if len(s.Monitors) == 0 {
+			s.Monitors = append([]MonitorValueType{SyntheticRX, TotalSyntheticRX, CPU}, ReadMonitorValueTypes...)
+		}
+	case TCPSource:
+		if s.DataSize == 0 {
+			return fmt.Errorf("%s: tcp source requires a dataSize", s.Name)
+		}
+		if len(s.Monitors) == 0 {
+			s.Monitors = lo.Flatten([][]MonitorValueType{TCPMonitorValueTypes, ReadMonitorValueTypes})
+		}
+	default:
+		return fmt.Errorf("%s: unknown source %q", s.Name, s.Source)
+	}
+
+	switch s.Traffic.Kind {
+	case BulkTraffic:
+	case PacedTraffic:
+		if s.Traffic.Rate == 0 {
+			return fmt.Errorf("%s: paced traffic requires a rate or a limit", s.Name)
+		}
+		if s.Traffic.ChunkInterval < 0 {
+			return fmt.Errorf("%s: chunkInterval can not be negative", s.Name)
+		}
+		for _, spike := range s.Traffic.Spikes {
+			if spike.End <= spike.Start || spike.Multiplier <= 0 {
+				return fmt.Errorf("%s: invalid spike %v-%v x%.2f", s.Name, spike.Start, spike.End, spike.Multiplier)
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unknown traffic kind %q", s.Name, s.Traffic.Kind)
+	}
+
+	for i, step := range s.LimitSteps {
+		if s.Limit == 0 || step.Limit <= 0 {
+			return fmt.Errorf("%s: limit steps require a limit and positive step limits", s.Name)
+		}
+		if step.At <= 0 || (i > 0 && step.At <= s.LimitSteps[i-1].At) {
+			return fmt.Errorf("%s: limit steps must be at increasing positive times", s.Name)
+		}
+	}
+
+	for _, monitor := range s.Monitors {
+		if _, ok := monitorGraphTitles[monitor]; !ok {
+			return fmt.Errorf("%s: unknown monitor %q", s.Name, monitor)
+		}
+	}
+
+	return nil
+}
+
+func (s Scenario) Parameters() BenchmarkParameters {
+	return BenchmarkParameters{
+		DataSize:   s.DataSize,
+		BufferSize: s.BufferSize,
+		Limit:      s.Limit,
+		Duration:   s.Duration,
+		Traffic:    s.Traffic,
+		LimitSteps: s.LimitSteps,
+	}
+}
+
+func (s Scenario) limit() int {
+	return s.Parameters().limit()
+}
+
+func (s Scenario) BenchmarkTest() BenchmarkTest {
+	return func(readerFactory ReaderFactory) {
+		switch s.Source {
+		case SyntheticSource:
+			runSyntheticScenario(s, readerFactory)
+		case TCPSource:
+			runTCPScenario(s, readerFactory)
+		}
+	}
+}
+
+func runSyntheticScenario(s Scenario, readerFactory ReaderFactory) {
+	reader := &syntheticReader{size: uint64(s.DataSize)}
+	limitedReader := readerFactory(reader, int(s.BufferSize), s.limit())
+
+	start := time.Now()
+	total, err := readScenarioData(limitedReader, int(s.BufferSize), time.Duration(s.Duration), s.LimitSteps)
+	elapsed := time.Since(start)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	if s.DataSize > 0 && s.Duration == 0 && total != int(s.DataSize) {
+		fmt.Printf("Read incomplete data, read: %d expected: %d\n", total, s.DataSize)
+	}
+
+	fmt.Printf("%s: Read %.3f MB, Took %v\n", s.Name, float64(total)/1024.0/1024.0, elapsed)
+}
+
+func runTCPScenario(s Scenario, readerFactory ReaderFactory) {
+	dataSize := int(s.DataSize)
+	var elapsed time.Duration
+
+	rf := func(connReader io.ReadCloser) (int, error) {
+		rateLimitedReader := readerFactory(connReader, int(s.BufferSize), s.limit())
+
+		start := time.Now()
+		total, err := readScenarioData(rateLimitedReader, int(s.BufferSize), time.Duration(s.Duration), s.LimitSteps)
+		elapsed = time.Since(start)
+		if err != nil {
+			fmt.Printf("Unexpected error while reading: %v\n", err)
+		}
+		if s.Duration == 0 && total != dataSize {
+			fmt.Printf("Read incomplete data, read: %d expected: %d\n", total, dataSize)
+		}
+
+		return total, err
+	}
+
+	go func() {
+		// give the server a sec to start
+		time.Sleep(100 * time.Millisecond)
+
+		n, err := sendTraffic(dataSize, s.Traffic)
+		if err != nil && s.Duration == 0 {
+			fmt.Println("Failed to send message:", err)
+		}
+		if n != dataSize && s.Duration == 0 {
+			fmt.Printf("Failed to send message: sent insufficient size=%d expectedSize=%d\n", n, dataSize)
+		}
+	}()
+
+	n, err := receiveOnceTCPServer(rf)
+	if err != nil && err != io.EOF {
+		fmt.Printf("Unexpected error from server: %v\n", err)
+	}
+
+	fmt.Printf("%s: Received %.3f MB, Took %v\n", s.Name, float64(n)/1024.0/1024.0, elapsed)
+}
+
+// readScenarioData reads until EOF or the duration passed, changing the limit between reads when a step is due.
+func readScenarioData(reader io.Reader, bufferSize int, duration time.Duration, steps []LimitStep) (int, error) {
+	var total int
+	buffer := make([]byte, bufferSize)
+
+	start := time.Now()
+	var deadline time.Time
+	if duration > 0 {
+		deadline = start.Add(duration)
+	}
+
+	for deadline.IsZero() || time.Now().Before(deadline) {
+		if len(steps) > 0 && time.Since(start) >= time.Duration(steps[0].At) {
+			if !SetReaderLimit(reader, int(steps[0].Limit)) {
+				fmt.Printf("Reader does not support limit changes, keeping its limit at %v\n", steps[0].At)
+			}
+			steps = steps[1:]
+		}
+
+		n, err := reader.Read(buffer)
+		total += n
+		if err != nil {
+			if err == io.EOF {
+				return total, nil
+			}
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+func writePacedTraffic(connWriter io.Writer, dataSize int, traffic TrafficShape) (int, error) {
+	interval := time.Duration(traffic.ChunkInterval)
+	chunkSize := traffic.chunkSize()
+
+	maxMultiplier := 1.0
+	for _, spike := range traffic.Spikes {
+		maxMultiplier = math.Max(maxMultiplier, spike.Multiplier)
+	}
+	message := []byte(strings.Repeat("A", int(float64(chunkSize)*maxMultiplier)+1))
+
+	var total int
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for total < dataSize {
+		<-ticker.C
+		size := int(float64(chunkSize) * traffic.multiplierAt(time.Since(start)))
+		size = min(size, dataSize-total, len(message))
+
+		n, err := connWriter.Write(message[:size])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+func (t TrafficShape) chunkSize() int {
+	return max(int(float64(t.Rate)*time.Duration(t.ChunkInterval).Seconds()), 1)
+}
+
+// offeredBytes returns how many bytes the paced sender schedule sends in the elapsed time,
+// the sender falls behind it when the receiver does not keep up.
+func (t TrafficShape) offeredBytes(elapsed time.Duration, dataSize int) int {
+	interval := time.Duration(t.ChunkInterval)
+	var total int
+	for tick := interval; tick <= elapsed && total < dataSize; tick += interval {
+		total += int(float64(t.chunkSize()) * t.multiplierAt(tick))
+	}
+	return min(total, dataSize)
+}
+
+func (t TrafficShape) multiplierAt(elapsed time.Duration) float64 {
+	for _, spike := range t.Spikes {
+		if elapsed >= time.Duration(spike.Start) && elapsed < time.Duration(spike.End) {
+			return spike.Multiplier
+		}
+	}
+	return 1
+}
+
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   float64
+}{
+	{"GB", 1024 * 1024 * 1024},
+	{"MB", 1024 * 1024},
+	{"KB", 1024},
+	{"B", 1},
+}
+
+func ParseByteSize(value string) (ByteSize, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := 1.0
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", value)
+	}
+	return ByteSize(number * multiplier), nil
+}
+
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var number int64
+	if err := json.Unmarshal(data, &number); err == nil {
+		*b = ByteSize(number)
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("byte size must be a number or a string like \"32KB\"")
+	}
+
+	size, err := ParseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\"")
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
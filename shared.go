@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/samber/lo"
+)
+
+// SharedLimitParameters cap the aggregate rate of the connections, each of them could take the whole limit alone.
+var SharedLimitParameters = BenchmarkParameters{
+	BufferSize: 32 * 1024, // 32KB classic io.Copy
+	Limit:      25 * 1024 * 1024,
+	Duration:   Duration(4 * time.Second),
+}
+
+// sharedConnections is the amount of TCP clients reading through the shared limiter.
+var sharedConnections = 8
+
+// FairnessSummary holds how evenly the connections sharing a limiter were served.
+type FairnessSummary struct {
+	Connections int
+	JainIndex   float64 // (sum x)^2 / (n * sum x^2) of the connection rates, 1 when even, 1/n when a connection took it all
+	MinRate     float64 // bytes per second of the slowest connection
+	MaxRate     float64 // bytes per second of the fastest connection
+}
+
+// NewFairnessSummary summarizes the bytes every connection read during the duration.
+func NewFairnessSummary(connectionsBytes []int, duration time.Duration) *FairnessSummary {
+	rates := lo.Map(connectionsBytes, func(bytes int, _ int) float64 { return float64(bytes) / duration.Seconds() })
+	summary := &FairnessSummary{
+		Connections: len(rates),
+		JainIndex:   jainFairnessIndex(rates),
+	}
+	if len(rates) > 0 {
+		summary.MinRate, summary.MaxRate = lo.Min(rates), lo.Max(rates)
+	}
+	return summary
+}
+
+func jainFairnessIndex(values []float64) float64 {
+	sumSquares := lo.SumBy(values, func(value float64) float64 { return value * value })
+	if sumSquares == 0 {
+		return 0
+	}
+	return math.Pow(lo.Sum(values), 2) / (float64(len(values)) * sumSquares)
+}
+
+// RunBenchmarkSharedLimitRealWorldLocal reads the connections through one limiter per reader, skipping readers
+// without a shared factory. The clients always send from the benchmark process.
+func RunBenchmarkSharedLimitRealWorldLocal(readers []RegisteredReader) BenchmarkData {
+	monitors := lo.Flatten([][]MonitorValueType{TCPMonitorValueTypes, ReadMonitorValueTypes})
+	bufferSize := int(SharedLimitParameters.BufferSize)
+	limit := SharedLimitParameters.limit()
+
+	result := make(BenchmarkData)
+	for _, reader := range readers {
+		if reader.SharedFactory == nil {
+			continue
+		}
+		var connectionsBytes []int
+		run := func() {
+			fmt.Printf("Starting SharedLimitRealWorldLocalTest using %s with %d connections...\n", reader.Type, sharedConnections)
+			connectionsBytes = SharedLimitRealWorldLocalTest(instrumentedReaderFactory(reader.SharedFactory(bufferSize, limit)))
+			time.Sleep(250 * time.Millisecond)
+			fmt.Printf("Finished SharedLimitRealWorldLocalTest using %s\n", reader.Type)
+			time.Sleep(250 * time.Millisecond)
+		}
+		readerData := runWithMonitor(run, ReadRX, SharedLimitParameters, string(reader.Type), reader.Color, monitors)
+
+		series := readerData[ReadRX]
+		series.Fairness = NewFairnessSummary(connectionsBytes, time.Duration(SharedLimitParameters.Duration))
+		readerData[ReadRX] = series
+		fmt.Printf("%s fairness: Jain's index %.3f | connection rates %s - %s\n", reader.Type,
+			series.Fairness.JainIndex, formatRate(series.Fairness.MinRate), formatRate(series.Fairness.MaxRate))
+		result[reader.Type] = readerData
+	}
+	return result
+}
+
+// SharedLimitRealWorldLocalTest connects the clients, then reads all of them for the duration through the readers
+// of the factory, which share their limiter. It returns the bytes read from every connection.
+func SharedLimitRealWorldLocalTest(readerFactory ReaderFactory) []int {
+	connectionLimits := lo.Times(sharedConnections, func(_ int) int { return SharedLimitParameters.limit() })
+	connectionsBytes := lo.Map(readConnectionsTest(readerFactory, SharedLimitParameters, connectionLimits), func(buckets []int, _ int) int {
+		return lo.Sum(buckets)
+	})
+
+	duration := time.Duration(SharedLimitParameters.Duration)
+	fmt.Printf("SharedLimitRealWorldLocalTest read %s over %d connections in %v\n",
+		formatRate(float64(lo.Sum(connectionsBytes))/duration.Seconds()), sharedConnections, duration)
+	return connectionsBytes
+}
+
+// connectionBucket is the time span the bytes read by the connections are counted by, see readConnectionsTest.
+const connectionBucket = 100 * time.Millisecond
+
+// readConnectionsTest connects a client per connection limit, then reads all of them for the duration,
+// the readers of a connection are created with its limit. It returns the bytes read from every connection
+// in every connectionBucket since the test start.
+func readConnectionsTest(readerFactory ReaderFactory, parameters BenchmarkParameters, connectionLimits []int) [][]int {
+	bufferSize := int(parameters.BufferSize)
+	duration := time.Duration(parameters.Duration)
+
+	// the connections start reading a moment after the test, a second covers it
+	start := time.Now()
+	buckets := int((duration+time.Second)/connectionBucket) + 1
+	connectionsBytes := lo.Times(len(connectionLimits), func(_ int) []int { return make([]int, buckets) })
+
+	// the connections are read in any order, each one takes the next limit
+	var started atomic.Int32
+	rf := func(connReader io.ReadCloser) (int, error) {
+		i := started.Add(1) - 1
+		rateLimitedReader := readerFactory(connReader, bufferSize, connectionLimits[i])
+
+		var total int
+		buffer := make([]byte, bufferSize)
+		deadline := time.Now().Add(duration)
+		for time.Now().Before(deadline) {
+			n, err := rateLimitedReader.Read(buffer)
+			total += n
+			connectionsBytes[i][min(int(time.Since(start)/connectionBucket), buckets-1)] += n
+			if err != nil {
+				fmt.Printf("Unexpected error while reading: %v\n", err)
+				return total, err
+			}
+		}
+		return total, nil
+	}
+
+	var senders sync.WaitGroup
+	for range connectionLimits {
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			// give the server a sec to start
+			time.Sleep(100 * time.Millisecond)
+			// the server closes the connection after the duration, ending the writes with an error
+			sendTCPMessage(endlessWriteFunc(bufferSize))
+		}()
+	}
+
+	_, err := receiveTCPServer(len(connectionLimits), rf)
+	if err != nil {
+		fmt.Printf("Unexpected error from server: %v\n", err)
+	}
+	senders.Wait()
+	return connectionsBytes
+}
+
+// endlessWriteFunc writes buffers until the connection fails.
+func endlessWriteFunc(bufferSize int) writeFunc {
+	return func(connWriter io.WriteCloser) (int, error) {
+		var total int
+		buffer := []byte(strings.Repeat("A", bufferSize))
+		for {
+			n, err := connWriter.Write(buffer)
+			total += n
+			if err != nil {
+				return total, nil
+			}
+		}
+	}
+}
+
+func BenchmarkSharedLimitRealWorldLocalGraph(data BenchmarkData) []*charts.Line {
+	title := "Shared Limit"
+	subtitle := fmt.Sprintf("%d connections reading for %v through one %s/s limiter",
+		sharedConnectionsOf(data), time.Duration(SharedLimitParameters.Duration), formatByteSize(SharedLimitParameters.Limit))
+	return append(MonitorGraphs(title, subtitle, nil, data, []MonitorValueType{ConnRX, ReadRX, CPU, ReadLatency}),
+		fairnessChart(title+" - Connection Rates MB/s", subtitle, RegisteredReadersSeries(data, ReadRX)))
+}
+
+// sharedConnectionsOf returns the connections recorded with the data, which may be loaded from another run.
+func sharedConnectionsOf(data BenchmarkData) int {
+	for _, readerData := range data {
+		if fairness := readerData[ReadRX].Fairness; fairness != nil {
+			return fairness.Connections
+		}
+	}
+	return sharedConnections
+}
+
+// fairnessChart draws the slowest, even and fastest connection rates of every reader.
+func fairnessChart(title, subtitle string, series []SeriesData) *charts.Line {
+	graph := NewCategoryChart(title, subtitle, []string{"slowest", "even share", "fastest"})
+
+	for _, s := range series {
+		if s.Fairness == nil || s.Fairness.Connections == 0 {
+			continue
+		}
+		evenShare := float64(SharedLimitParameters.Limit) / float64(s.Fairness.Connections)
+		items := lo.Map([]float64{s.Fairness.MinRate, evenShare, s.Fairness.MaxRate}, func(rate float64, _ int) opts.LineData {
+			return opts.LineData{Value: rate / mb}
+		})
+		AddCategorySeries(graph, s.Title, s.Color, items)
+	}
+
+	return graph
+}
+
+// fairnessTable formats the fairness of the readers sharing a limiter, a row per reader.
+func fairnessTable(benchmarkType BenchmarkType, data BenchmarkData) summaryTable {
+	table := summaryTable{
+		title:  string(benchmarkType) + " Fairness",
+		header: []string{"Reader", "Connections", "Jain's Index", "Slowest Connection", "Fastest Connection"},
+	}
+	for _, readerType := range sortedReaderTypes(data) {
+		series, ok := data[readerType].SummarySeries()
+		if !ok || series.Fairness == nil {
+			continue
+		}
+		f := series.Fairness
+		table.rows = append(table.rows, []string{
+			string(readerType),
+			fmt.Sprintf("%d", f.Connections),
+			fmt.Sprintf("%.3f", f.JainIndex),
+			formatRate(f.MinRate),
+			formatRate(f.MaxRate),
+		})
+	}
+	return table
+}
+
+// getBenchmarkReaderFairnessAverage averages the fairness summaries of the iterations that recorded them.
+func getBenchmarkReaderFairnessAverage(benchmarkResults []AllBenchmarkData, benchmarkType BenchmarkType, readerType ReaderType, monitorType MonitorValueType) *FairnessSummary {
+	summaries := lo.FilterMap(benchmarkResults, func(benchmarkResult AllBenchmarkData, _ int) (*FairnessSummary, bool) {
+		summary := benchmarkResult[benchmarkType][readerType][monitorType].Fairness
+		return summary, summary != nil
+	})
+	if len(summaries) == 0 {
+		return nil
+	}
+
+	amount := float64(len(summaries))
+	return &FairnessSummary{
+		Connections: summaries[0].Connections,
+		JainIndex:   lo.SumBy(summaries, func(s *FairnessSummary) float64 { return s.JainIndex }) / amount,
+		MinRate:     lo.SumBy(summaries, func(s *FairnessSummary) float64 { return s.MinRate }) / amount,
+		MaxRate:     lo.SumBy(summaries, func(s *FairnessSummary) float64 { return s.MaxRate }) / amount,
+	}
+}
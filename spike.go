@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// spikeSettlingTolerance is the band around the limit the reader rate has to stay within to count as settled.
+const spikeSettlingTolerance = 0.10
+
+// SpikeRecovery describes how a reader handled a sender spike. Times are measured from the first sample with
+// data, so they are accurate to a sampling interval.
+type SpikeRecovery struct {
+	Start            time.Duration
+	End              time.Duration
+	PeakRate         float64       // highest bytes per second returned during the spike
+	Settled          bool          // the rate got back within the tolerance band before the next spike or the test end
+	SettlingTime     time.Duration // after the spike end until the rate stays within the tolerance band of the limit
+	PeakBacklog      float64       // most bytes offered by the sender schedule and not read yet
+	Drained          bool          // the backlog got down to a single interval at the limit
+	BacklogDrainTime time.Duration // after the spike end until the backlog is drained
+}
+
+// NewSpikeRecoveries analyzes the spikes of paced traffic, intervalsBytes are the ReadRX samples from the first read.
+func NewSpikeRecoveries(intervalsBytes []uint64, interval time.Duration, parameters BenchmarkParameters) []SpikeRecovery {
+	traffic := parameters.Traffic
+	if traffic.Kind != PacedTraffic || len(traffic.Spikes) == 0 || parameters.Limit <= 0 || len(intervalsBytes) == 0 {
+		return nil
+	}
+
+	limitPerInterval := float64(parameters.Limit) * interval.Seconds()
+	backlogs := make([]float64, len(intervalsBytes))
+	var read uint64
+	for i, bytes := range intervalsBytes {
+		read += bytes
+		offered := traffic.offeredBytes(time.Duration(i+1)*interval, int(parameters.DataSize))
+		backlogs[i] = max(float64(offered)-float64(read), 0)
+	}
+
+	recoveries := make([]SpikeRecovery, 0)
+	for i, spike := range traffic.Spikes {
+		start, end := time.Duration(spike.Start), time.Duration(spike.End)
+		startIndex := min(int(start/interval), len(intervalsBytes))
+		endIndex := min(int(math.Ceil(float64(end)/float64(interval))), len(intervalsBytes))
+
+		// the rate has to settle before the next spike, the last sample is partial
+		windowEnd := len(intervalsBytes) - 1
+		if i+1 < len(traffic.Spikes) {
+			windowEnd = min(int(time.Duration(traffic.Spikes[i+1].Start)/interval), windowEnd)
+		}
+		windowEnd = max(windowEnd, endIndex)
+
+		recovery := SpikeRecovery{
+			Start:        start,
+			End:          end,
+			PeakRate:     float64(lo.Max(intervalsBytes[startIndex:endIndex])) / interval.Seconds(),
+			SettlingTime: max(time.Duration(windowEnd)*interval-end, 0),
+			PeakBacklog:  lo.Max(backlogs[startIndex:windowEnd]),
+		}
+
+		for k := endIndex; k < windowEnd; k++ {
+			withinBand := lo.EveryBy(intervalsBytes[k:windowEnd], func(bytes uint64) bool {
+				return math.Abs(float64(bytes)-limitPerInterval) <= limitPerInterval*spikeSettlingTolerance
+			})
+			if withinBand {
+				recovery.Settled = true
+				recovery.SettlingTime = max(time.Duration(k)*interval-end, 0)
+				break
+			}
+		}
+
+		recovery.BacklogDrainTime = time.Duration(len(intervalsBytes))*interval - end
+		for k := max(endIndex-1, 0); k < len(backlogs); k++ {
+			if backlogs[k] <= limitPerInterval {
+				recovery.Drained = true
+				recovery.BacklogDrainTime = max(time.Duration(k+1)*interval-end, 0)
+				break
+			}
+		}
+
+		recoveries = append(recoveries, recovery)
+	}
+	return recoveries
+}
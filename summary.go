@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// BenchmarkSummary holds the whole test metrics of a reader, comparing what it returned with the configured limit,
+// or of a writer, comparing what it accepted. Limit related metrics are zero for unlimited tests.
+type BenchmarkSummary struct {
+	Throughput          float64       // average bytes per second between the first Read call and the last return
+	Limit               float64       // configured bytes per second, averaged over the elapsed time with limit steps
+	ErrorPercent        float64       // throughput deviation from the limit
+	CV                  float64       // coefficient of variation of the bytes per interval
+	MaxOvershootPercent float64       // highest interval rate above the limit
+	Elapsed             time.Duration // first Read call to the last return
+	TheoreticalElapsed  time.Duration // data size at the limit rate, following the limit steps
+	CPUSeconds          float64       // benchmark process user and system time during the test
+	AllocBytes          float64       // benchmark process heap bytes allocated during the test
+	Allocs              float64       // benchmark process heap objects allocated during the test
+
+	SpikeRecoveries   []SpikeRecovery    `json:",omitempty"` // paced traffic spikes only
+	LimitConvergences []LimitConvergence `json:",omitempty"` // limit steps only
+	Iterations        []BenchmarkSummary `json:",omitempty"` // the summaries averaged into this one, kept for comparisons
+}
+
+// Samples returns the summary of every iteration behind the summary, itself for a single run.
+func (s BenchmarkSummary) Samples() []BenchmarkSummary {
+	if len(s.Iterations) > 0 {
+		return s.Iterations
+	}
+	return []BenchmarkSummary{s}
+}
+
+// NewBenchmarkSummary summarizes the bytes of the monitor, one of SummaryMonitorValueTypes.
+func NewBenchmarkSummary(results []monitorResult, monitor MonitorValueType, parameters BenchmarkParameters, totalBytes uint64,
+	elapsed time.Duration, cpuSeconds float64) *BenchmarkSummary {
+
+	summary := &BenchmarkSummary{
+		Limit:      float64(parameters.Limit),
+		Elapsed:    elapsed,
+		CPUSeconds: cpuSeconds,
+	}
+	if elapsed > 0 {
+		summary.Throughput = float64(totalBytes) / elapsed.Seconds()
+	}
+
+	intervalsBytes := activeIntervalsBytes(results, monitor)
+	if len(intervalsBytes) > 2 {
+		// the first and last intervals are partial
+		summary.CV = coefficientOfVariation(intervalsBytes[1 : len(intervalsBytes)-1])
+	}
+
+	if parameters.Limit > 0 {
+		summary.Limit = parameters.averageLimit(elapsed)
+		summary.ErrorPercent = (summary.Throughput - summary.Limit) / summary.Limit * 100
+		for i, bytes := range intervalsBytes {
+			rate := float64(bytes) / monitorInterval.Seconds()
+			overshoot := max(rate/parameters.limitAt(time.Duration(i)*monitorInterval)-1, 0) * 100
+			summary.MaxOvershootPercent = max(summary.MaxOvershootPercent, overshoot)
+		}
+		if parameters.DataSize > 0 {
+			summary.TheoreticalElapsed = parameters.scheduledElapsed()
+		}
+	}
+
+	summary.SpikeRecoveries = NewSpikeRecoveries(intervalsBytes, monitorInterval, parameters)
+	summary.LimitConvergences = NewLimitConvergences(intervalsBytes, monitorInterval, parameters)
+
+	return summary
+}
+
+// activeIntervalsBytes returns the ReadRX or WriteTX samples without the idle intervals before and after the test.
+func activeIntervalsBytes(results []monitorResult, monitor MonitorValueType) []uint64 {
+	intervalBytes := func(item monitorResult, _ int) uint64 {
+		if monitor == WriteTX {
+			return item.writeTXDelta
+		}
+		return item.readRXDelta
+	}
+
+	first, last := -1, -1
+	for i, item := range results {
+		if intervalBytes(item, i) > 0 {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first == -1 {
+		return nil
+	}
+	return lo.Map(results[first:last+1], intervalBytes)
+}
+
+// SummarySeries returns the series holding the whole test summary, the first of SummaryMonitorValueTypes recorded with one.
+func (d BenchmarkReaderData) SummarySeries() (SeriesData, bool) {
+	for _, monitor := range SummaryMonitorValueTypes {
+		if series, ok := d[monitor]; ok && series.Summary != nil {
+			return series, true
+		}
+	}
+	return SeriesData{}, false
+}
+
+// RegisteredReadersSummarySeries returns the summary series of the readers, skipping readers recorded without one.
+func RegisteredReadersSummarySeries(data BenchmarkData) []SeriesData {
+	series := make([]SeriesData, 0)
+	for _, readerType := range sortedReaderTypes(data) {
+		if summarySeries, ok := data[readerType].SummarySeries(); ok {
+			series = append(series, summarySeries)
+		}
+	}
+	return series
+}
+
+func coefficientOfVariation(values []uint64) float64 {
+	mean := float64(lo.Sum(values)) / float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+
+	var variance float64
+	for _, value := range values {
+		variance += math.Pow(float64(value)-mean, 2)
+	}
+	variance /= float64(len(values))
+	return math.Sqrt(variance) / mean
+}
+
+type summaryTable struct {
+	title  string
+	header []string
+	rows   [][]string
+}
+
+// summaryTables formats the summaries of the registered readers, skipping readers recorded without one
+// and tables without any rows.
+func summaryTables(benchmarkType BenchmarkType, data BenchmarkData) []summaryTable {
+	summary := summaryTable{
+		title:  string(benchmarkType),
+		header: []string{"Reader", "Throughput", "Limit", "Error", "CV", "Max Overshoot", "Elapsed", "Theoretical", "CPU Seconds"},
+	}
+	spikes := summaryTable{
+		title:  string(benchmarkType) + " Spike Recovery",
+		header: []string{"Reader", "Spike", "Peak Rate", "Settling Time", "Peak Backlog", "Backlog Drain Time"},
+	}
+	convergences := summaryTable{
+		title:  string(benchmarkType) + " Limit Convergence",
+		header: []string{"Reader", "Step", "Limit", "Rate", "Convergence Time"},
+	}
+
+	for _, series := range RegisteredReadersSummarySeries(data) {
+		s := series.Summary
+
+		limit, errorPercent, overshoot, theoretical := "unlimited", "-", "-", "-"
+		if s.Limit > 0 {
+			limit = formatRate(s.Limit)
+			errorPercent = fmt.Sprintf("%+.2f%%", s.ErrorPercent)
+			overshoot = fmt.Sprintf("%.2f%%", s.MaxOvershootPercent)
+		}
+		if s.TheoreticalElapsed > 0 {
+			theoretical = formatSummaryDuration(s.TheoreticalElapsed)
+		}
+
+		summary.rows = append(summary.rows, []string{
+			series.Title,
+			formatRate(s.Throughput),
+			limit,
+			errorPercent,
+			fmt.Sprintf("%.3f", s.CV),
+			overshoot,
+			formatSummaryDuration(s.Elapsed),
+			theoretical,
+			fmt.Sprintf("%.2f", s.CPUSeconds),
+		})
+
+		for _, recovery := range s.SpikeRecoveries {
+			settlingTime := formatSummaryDuration(recovery.SettlingTime)
+			if !recovery.Settled {
+				settlingTime = "> " + settlingTime
+			}
+			drainTime := formatSummaryDuration(recovery.BacklogDrainTime)
+			if !recovery.Drained {
+				drainTime = "> " + drainTime
+			}
+
+			spikes.rows = append(spikes.rows, []string{
+				series.Title,
+				fmt.Sprintf("%v-%v", recovery.Start, recovery.End),
+				formatRate(recovery.PeakRate),
+				settlingTime,
+				fmt.Sprintf("%.2fMB", recovery.PeakBacklog/1024/1024),
+				drainTime,
+			})
+		}
+
+		for _, convergence := range s.LimitConvergences {
+			convergenceTime := formatSummaryDuration(convergence.ConvergenceTime)
+			if !convergence.Converged {
+				convergenceTime = "> " + convergenceTime
+			}
+
+			convergences.rows = append(convergences.rows, []string{
+				series.Title,
+				convergence.At.String(),
+				formatRate(convergence.Limit),
+				formatRate(convergence.Rate),
+				convergenceTime,
+			})
+		}
+	}
+
+	tables := []summaryTable{summary, spikes, convergences,
+		cancellationTable(benchmarkType, data), fairnessTable(benchmarkType, data), hierarchyTable(benchmarkType, data)}
+	return lo.Filter(tables, func(table summaryTable, _ int) bool { return len(table.rows) > 0 })
+}
+
+// formatRate shows rates below a MB per second in KB, so the low rate benchmarks do not round to zero.
+func formatRate(bytesPerSecond float64) string {
+	if bytesPerSecond < mb {
+		return fmt.Sprintf("%.2fKB/s", bytesPerSecond/kb)
+	}
+	return fmt.Sprintf("%.2fMB/s", bytesPerSecond/mb)
+}
+
+func formatSummaryDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+// PrintSummaryTables prints the summary tables of every benchmark, in the given benchmarks order.
+func PrintSummaryTables(w io.Writer, benchmarkTypes []BenchmarkType, benchmark AllBenchmarkData) {
+	printTables(w, allSummaryTables(benchmarkTypes, benchmark))
+}
+
+// SummaryTablesHTML renders the summary tables to be embedded in the graphs page.
+func SummaryTablesHTML(benchmarkTypes []BenchmarkType, benchmark AllBenchmarkData) string {
+	return tablesHTML(allSummaryTables(benchmarkTypes, benchmark))
+}
+
+func allSummaryTables(benchmarkTypes []BenchmarkType, benchmark AllBenchmarkData) []summaryTable {
+	tables := make([]summaryTable, 0)
+	for _, benchmarkType := range benchmarkTypes {
+		tables = append(tables, summaryTables(benchmarkType, benchmark[benchmarkType])...)
+	}
+	return tables
+}
+
+func printTables(w io.Writer, tables []summaryTable) {
+	for _, table := range tables {
+		fmt.Fprintf(w, "\n%s\n", table.title)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(table.header, "\t"))
+		for _, row := range table.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		tw.Flush()
+	}
+}
+
+func tablesHTML(tables []summaryTable) string {
+	var sb strings.Builder
+	for _, table := range tables {
+		fmt.Fprintf(&sb, "<h3>%s</h3>\n<table class=\"summary\">\n<tr>", html.EscapeString(table.title))
+		for _, title := range table.header {
+			fmt.Fprintf(&sb, "<th>%s</th>", html.EscapeString(title))
+		}
+		sb.WriteString("</tr>\n")
+		for _, row := range table.rows {
+			sb.WriteString("<tr>")
+			for _, cell := range row {
+				fmt.Fprintf(&sb, "<td>%s</td>", html.EscapeString(cell))
+			}
+			sb.WriteString("</tr>\n")
+		}
+		sb.WriteString("</table>\n")
+	}
+
+	if sb.Len() == 0 {
+		return ""
+	}
+	return `<style>
+  .summary { border-collapse: collapse; font-family: sans-serif; font-size: 13px; margin: 0 20px 20px; }
+  .summary th, .summary td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+  .summary th:first-child, .summary td:first-child { text-align: left; }
+  h3 { font-family: sans-serif; margin: 20px 20px 8px; }
+</style>
+` + sb.String()
+}
+
+func printTablesMarkdown(w io.Writer, tables []summaryTable) {
+	escape := strings.NewReplacer("|", "\\|")
+	for _, table := range tables {
+		fmt.Fprintf(w, "\n### %s\n\n", table.title)
+		fmt.Fprintf(w, "| %s |\n", strings.Join(table.header, " | "))
+		fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(table.header)))
+		for _, row := range table.rows {
+			cells := lo.Map(row, func(cell string, _ int) string { return escape.Replace(cell) })
+			fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import "github.com/samber/lo"
+
+// Unit is the unit of the raw values of a series, the graphs convert them to the display units of monitorGraphTitles.
+type Unit string
+
+const (
+	UnitBytes   Unit = "bytes"
+	UnitPercent Unit = "percent"
+	UnitCount   Unit = "count"
+	UnitSeconds Unit = "seconds"
+)
+
+var monitorUnits = map[MonitorValueType]Unit{
+	RX:               UnitBytes,
+	ConnRX:           UnitBytes,
+	ReadRX:           UnitBytes,
+	SyntheticRX:      UnitBytes,
+	TotalSyntheticRX: UnitBytes,
+	CPU:              UnitPercent,
+	RAM:              UnitBytes,
+	GoHeap:           UnitBytes,
+	SenderCPU:        UnitPercent,
+	SenderRAM:        UnitBytes,
+	HeapAllocs:       UnitBytes,
+	AllocsPerRead:    UnitCount,
+	GCCycles:         UnitCount,
+	GCPause:          UnitSeconds,
+	Goroutines:       UnitCount,
+	ReadLatency:      UnitSeconds,
+	ReadGap:          UnitSeconds,
+	TX:               UnitBytes,
+	ConnTX:           UnitBytes,
+	WriteTX:          UnitBytes,
+	WriteLatency:     UnitSeconds,
+	CancelLatency:    UnitSeconds,
+	CloseLatency:     UnitSeconds,
+}
+
+const (
+	kb = 1024.0
+	mb = 1024.0 * 1024.0
+)
+
+// unitDisplayScales divide the raw values of a unit into the display units, units missing from it are shown as is.
+var unitDisplayScales = map[Unit]float64{
+	UnitBytes:   mb,
+	UnitSeconds: 1e-6, // microseconds
+}
+
+// monitorDisplayScales override the display scale of the monitors shown in a smaller unit, for values in their own unit.
+var monitorDisplayScales = map[MonitorValueType]float64{
+	HeapAllocs: kb,
+}
+
+// displayScale returns the divisor converting values of the unit into the display units of the monitor.
+func displayScale(unit Unit, monitor MonitorValueType) float64 {
+	if scale, ok := monitorDisplayScales[monitor]; ok && unit == monitorUnits[monitor] {
+		return scale
+	}
+	if scale, ok := unitDisplayScales[unit]; ok {
+		return scale
+	}
+	return 1
+}
+
+func monitorDisplayScale(monitor MonitorValueType) float64 {
+	return displayScale(monitorUnits[monitor], monitor)
+}
+
+// DisplaySeries converts the raw series values to the display units of the monitor, from the unit of every series.
+// Series without a unit are taken to be in the monitor unit.
+func DisplaySeries(series []SeriesData, monitor MonitorValueType) []SeriesData {
+	return lo.Map(series, func(s SeriesData, _ int) SeriesData {
+		unit := s.Unit
+		if unit == "" {
+			unit = monitorUnits[monitor]
+		}
+		scale := displayScale(unit, monitor)
+		toDisplay := func(values []float64) []float64 {
+			return lo.Map(values, func(value float64, _ int) float64 { return value / scale })
+		}
+		s.Values = toDisplay(s.Values)
+		if s.Bands != nil {
+			s.Bands = &SeriesBands{
+				Iterations: s.Bands.Iterations,
+				Mean:       toDisplay(s.Bands.Mean),
+				Median:     toDisplay(s.Bands.Median),
+				P10:        toDisplay(s.Bands.P10),
+				P90:        toDisplay(s.Bands.P90),
+			}
+		}
+		return s
+	})
+}
@@ -14,10 +14,11 @@ import (
 	"golang.org/x/time/rate"
 )
 
-const (
-	LineTitle = "Bytes/0.2 Milliseconds"
-	LineText  = "#5470c6"
-)
+const LineText = "#5470c6"
+
+func usageLineTitle() string {
+	return fmt.Sprintf("Bytes/%v", monitorInterval)
+}
 
 func goRateLimitUsageOnGraph() *charts.Line {
 	const chunkSize = 1024
@@ -30,7 +31,7 @@ func goRateLimitUsageOnGraph() *charts.Line {
 	var total atomic.Int64
 	buffer := make([]byte, chunkSize)
 	ctx, ctxCancel := context.WithCancel(context.Background())
-	resultsC := make(chan []int)
+	resultsC := make(chan []float64)
 
 	go usagesMonitorLoop(ctx, &total, resultsC)
 	time.Sleep(300 * time.Millisecond)
@@ -65,9 +66,11 @@ func goRateLimitUsageOnGraph() *charts.Line {
 		nil,
 		MoveOverlappingSeriesData([]SeriesData{
 			{
-				Title:  LineTitle,
-				Values: results,
-				Color:  LineText,
+				Title:    usageLineTitle(),
+				Values:   results,
+				Unit:     UnitBytes,
+				Color:    LineText,
+				Interval: monitorInterval,
 			},
 		}),
 	)
@@ -84,7 +87,7 @@ func goRateLimitBurstsOnlyOnGraph() *charts.Line {
 	var total atomic.Int64
 	buffer := make([]byte, chunkSize)
 	ctx, ctxCancel := context.WithCancel(context.Background())
-	resultsC := make(chan []int)
+	resultsC := make(chan []float64)
 
 	go usagesMonitorLoop(ctx, &total, resultsC)
 	time.Sleep(300 * time.Millisecond)
@@ -142,9 +145,11 @@ func goRateLimitBurstsOnlyOnGraph() *charts.Line {
 		nil,
 		MoveOverlappingSeriesData([]SeriesData{
 			{
-				Title:  LineTitle,
-				Values: results,
-				Color:  LineText,
+				Title:    usageLineTitle(),
+				Values:   results,
+				Unit:     UnitBytes,
+				Color:    LineText,
+				Interval: monitorInterval,
 			},
 		}),
 	)
@@ -161,7 +166,7 @@ func uberRateLimitUsageOnGraph() *charts.Line {
 	var total atomic.Int64
 	buffer := make([]byte, chunkSize)
 	ctx, ctxCancel := context.WithCancel(context.Background())
-	resultsC := make(chan []int)
+	resultsC := make(chan []float64)
 
 	go usagesMonitorLoop(ctx, &total, resultsC)
 	time.Sleep(300 * time.Millisecond)
@@ -193,9 +198,11 @@ func uberRateLimitUsageOnGraph() *charts.Line {
 		nil,
 		MoveOverlappingSeriesData([]SeriesData{
 			{
-				Title:  LineTitle,
-				Values: results,
-				Color:  LineText,
+				Title:    usageLineTitle(),
+				Values:   results,
+				Unit:     UnitBytes,
+				Color:    LineText,
+				Interval: monitorInterval,
 			},
 		}),
 	)
@@ -212,7 +219,7 @@ func imadmonRateLimitUsageOnGraph() *charts.Line {
 	var total atomic.Int64
 	buffer := make([]byte, chunkSize)
 	ctx, ctxCancel := context.WithCancel(context.Background())
-	resultsC := make(chan []int)
+	resultsC := make(chan []float64)
 
 	go usagesMonitorLoop(ctx, &total, resultsC)
 	time.Sleep(300 * time.Millisecond)
@@ -242,19 +249,21 @@ func imadmonRateLimitUsageOnGraph() *charts.Line {
 		nil,
 		MoveOverlappingSeriesData([]SeriesData{
 			{
-				Title:  LineTitle,
-				Values: results,
-				Color:  LineText,
+				Title:    usageLineTitle(),
+				Values:   results,
+				Unit:     UnitBytes,
+				Color:    LineText,
+				Interval: monitorInterval,
 			},
 		}),
 	)
 }
 
-func usagesMonitorLoop(ctx context.Context, monitoredBytes *atomic.Int64, resultsC chan []int) {
-	ticker := time.NewTicker(200 * time.Millisecond)
+func usagesMonitorLoop(ctx context.Context, monitoredBytes *atomic.Int64, resultsC chan []float64) {
+	ticker := time.NewTicker(monitorInterval)
 	defer ticker.Stop()
 
-	results := make([]int, 0)
+	results := make([]float64, 0)
 	var prevResult int64
 	for {
 		select {
@@ -263,7 +272,7 @@ func usagesMonitorLoop(ctx context.Context, monitoredBytes *atomic.Int64, result
 			return
 		case <-ticker.C:
 			currentResult := monitoredBytes.Load()
-			results = append(results, int(currentResult-prevResult))
+			results = append(results, float64(currentResult-prevResult))
 			prevResult = currentResult
 		}
 	}
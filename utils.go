@@ -1,21 +1,29 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/samber/lo"
 )
 
 var (
 	serverAddress = "localhost:1238"
+	splitSender   = false // send TCP traffic from a child process so the monitors measure only the receiver
 )
 
 type readFunc func(io.ReadCloser) (int, error)
-type writeFunc func(io.Writer) (int, error)
+type writeFunc func(io.WriteCloser) (int, error)
 
 func receiveOnceTCPServer(rf readFunc) (int, error) {
 	ln, err := net.Listen("tcp", serverAddress)
@@ -33,11 +41,70 @@ func receiveOnceTCPServer(rf readFunc) (int, error) {
 	}
 	defer conn.Close()
 
-	n, err := rf(conn)
+	n, err := rf(&countingConn{conn})
 	fmt.Printf("Server received %d bytes\n", n)
 	return n, err
 }
 
+// receiveTCPServer accepts the connections, then reads them concurrently, returning the bytes rf read from each one.
+func receiveTCPServer(connections int, rf readFunc) ([]int, error) {
+	ln, err := net.Listen("tcp", serverAddress)
+	if err != nil {
+		fmt.Println("Server failed to start:", err)
+		return nil, err
+	}
+	defer ln.Close()
+	fmt.Printf("Server listening on %s for %d connections\n", serverAddress, connections)
+
+	conns := make([]net.Conn, 0, connections)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for len(conns) < connections {
+		conn, err := ln.Accept()
+		if err != nil {
+			fmt.Println("Failed to accept connection:", err)
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+
+	received := make([]int, connections)
+	errs := make([]error, connections)
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			received[i], errs[i] = rf(&countingConn{conn})
+		}()
+	}
+	wg.Wait()
+
+	fmt.Printf("Server received %d bytes from %d connections\n", lo.Sum(received), connections)
+	return received, errors.Join(errs...)
+}
+
+// countingConn counts the bytes read from and written to the connection in-process, unaffected by other traffic
+// on the interface.
+type countingConn struct {
+	net.Conn
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	ConnRXBytes.Add(uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	ConnTXBytes.Add(uint64(n))
+	return n, err
+}
+
 func sendTCPMessage(wf writeFunc) (int, error) {
 	fmt.Println("Sending message to", serverAddress)
 	conn, err := net.Dial("tcp", serverAddress)
@@ -47,46 +114,101 @@ func sendTCPMessage(wf writeFunc) (int, error) {
 	}
 	defer conn.Close()
 
-	n, err := wf(conn)
+	n, err := wf(&countingConn{conn})
 	fmt.Printf("Client sent %d bytes\n", n)
 	return n, err
 }
 
-func saveDataToFile(data AllBenchmarkData, filename string) {
-	file, err := os.Create(filename)
+func sendTraffic(dataSize int, traffic TrafficShape) (int, error) {
+	if splitSender {
+		return sendTrafficFromProcess(dataSize, traffic)
+	}
+	return sendTCPMessage(trafficWriteFunc(dataSize, traffic))
+}
+
+func trafficWriteFunc(dataSize int, traffic TrafficShape) writeFunc {
+	return func(connWriter io.WriteCloser) (int, error) {
+		if traffic.Kind == PacedTraffic {
+			return writePacedTraffic(connWriter, dataSize, traffic)
+		}
+		return connWriter.Write([]byte(strings.Repeat("A", dataSize)))
+	}
+}
+
+// senderSentFormat is the line the sender process reports the bytes it wrote with.
+const senderSentFormat = "Sender wrote %d bytes"
+
+func sendTrafficFromProcess(dataSize int, traffic TrafficShape) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	trafficJSON, err := json.Marshal(traffic)
+	if err != nil {
+		return 0, err
+	}
+
+	cmd := exec.Command(executable, "sender",
+		"-address", serverAddress,
+		"-size", strconv.Itoa(dataSize),
+		"-traffic", string(trafficJSON),
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	if err != nil {
+		return 0, err
+	}
+
+	SenderPID.Store(int32(cmd.Process.Pid))
+	defer SenderPID.Store(0)
+
+	// the sender reports the bytes it wrote, also when it failed midway
+	var sent int
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Println(line)
+		fmt.Sscanf(line, senderSentFormat, &sent)
+	}
+
+	err = cmd.Wait()
 	if err != nil {
-		fmt.Printf("Cannot create file: %v\n", err)
-		return
+		return sent, fmt.Errorf("sender process failed: %w", err)
 	}
-	defer file.Close()
+	return sent, nil
+}
 
+// saveDataToFile writes the results as JSON, a failure is returned so the command exits with an error.
+func saveDataToFile(data BenchmarkResults, filename string) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		fmt.Printf("Cannot marshal data: %v\n", err)
-		return
+		return fmt.Errorf("cannot marshal data: %w", err)
 	}
 
-	_, err = file.Write(jsonData)
+	err = os.WriteFile(filename, jsonData, 0644)
 	if err != nil {
-		fmt.Printf("Cannot write data: %v\n", err)
+		return fmt.Errorf("cannot write data: %w", err)
 	}
 
 	fmt.Printf("Saved data to file: %v\n", filename)
+	return nil
 }
 
-func loadDataFromFile(filename string) (AllBenchmarkData, error) {
-	file, err := os.Open(filename)
+func loadDataFromFile(filename string) (BenchmarkResults, error) {
+	raw, err := os.ReadFile(filename)
 	if err != nil {
 		fmt.Printf("Cannot open file: %v\n", err)
-		return nil, err
+		return BenchmarkResults{}, err
 	}
-	defer file.Close()
 
-	var data AllBenchmarkData
-	err = json.NewDecoder(file).Decode(&data)
+	data, err := migrateBenchmarkResults(raw)
 	if err != nil {
 		fmt.Printf("Cannot unmarshal data: %v\n", err)
-		return nil, err
+		return BenchmarkResults{}, err
 	}
 
 	fmt.Printf("Loaded data from file: %v\n", filename)
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/imadmon/limitedreader"
+	jujuratelimit "github.com/juju/ratelimit"
+	"go.uber.org/ratelimit"
+	"golang.org/x/time/rate"
+)
+
+// WriterFactory limits the sending side of a stream. Writers are registered under the reader type of the same limiter,
+// so the write benchmarks share the data, graphs and tables of the read ones.
+type WriterFactory func(writer io.WriteCloser, bufferSize, limit int) io.WriteCloser
+
+func init() {
+	RegisterWriter(GolangReader, "#5470c6",
+		"golang.org/x/time/rate bursts limiter, one token per buffer written",
+		GolangBurstsRateLimitWriterFactory)
+	RegisterWriter(JujuReader, "#ea7ccc",
+		"github.com/juju/ratelimit Writer, waits for the bytes before each Write",
+		JujuBurstsRateLimitWriterFactory)
+	RegisterWriter(UberReader, "#fac858",
+		"go.uber.org/ratelimit deterministic limiter, one Take per buffer written",
+		UberDeterministicRateLimitWriterFactory)
+	RegisterWriter(IMadmonReader, "#ee6666",
+		"github.com/imadmon/limitedreader pacing the written bytes",
+		IMadmonDeterministicRateLimitWriterFactory)
+}
+
+func GolangBurstsRateLimitWriterFactory(writer io.WriteCloser, bufferSize, limit int) io.WriteCloser {
+	writeSize := lowRateReadSize(bufferSize, limit)
+	return &GolangRateLimitedWriter{
+		writer:    writer,
+		limiter:   rate.NewLimiter(rate.Limit(limit/writeSize), limit/writeSize),
+		ctx:       context.Background(),
+		writeSize: writeSize,
+	}
+}
+
+type GolangRateLimitedWriter struct {
+	writer    io.WriteCloser
+	limiter   *rate.Limiter
+	ctx       context.Context
+	writeSize int
+}
+
+func (w *GolangRateLimitedWriter) Write(p []byte) (n int, err error) {
+	return writeChunks(w.writer, p, w.writeSize, func() error { return w.limiter.Wait(w.ctx) })
+}
+
+func (w *GolangRateLimitedWriter) Close() error {
+	return w.writer.Close()
+}
+
+func JujuBurstsRateLimitWriterFactory(writer io.WriteCloser, _, limit int) io.WriteCloser {
+	bucket := jujuratelimit.NewBucketWithRate(float64(limit), int64(limit))
+	return &JujuRateLimitedWriter{
+		Writer: jujuratelimit.Writer(writer, bucket),
+		closer: writer,
+	}
+}
+
+type JujuRateLimitedWriter struct {
+	io.Writer
+	closer io.Closer
+}
+
+func (w *JujuRateLimitedWriter) Close() error {
+	return w.closer.Close()
+}
+
+func UberDeterministicRateLimitWriterFactory(writer io.WriteCloser, bufferSize, limit int) io.WriteCloser {
+	writeSize := lowRateReadSize(bufferSize, limit)
+	return &UberRateLimitedWriter{
+		writer:    writer,
+		limiter:   ratelimit.New(limit / writeSize), // operations per second
+		writeSize: writeSize,
+	}
+}
+
+type UberRateLimitedWriter struct {
+	writer    io.WriteCloser
+	limiter   ratelimit.Limiter
+	writeSize int
+}
+
+func (w *UberRateLimitedWriter) Write(p []byte) (n int, err error) {
+	return writeChunks(w.writer, p, w.writeSize, func() error {
+		w.limiter.Take()
+		return nil
+	})
+}
+
+func (w *UberRateLimitedWriter) Close() error {
+	return w.writer.Close()
+}
+
+// IMadmonDeterministicRateLimitWriterFactory paces the written bytes by reading them through a limitedreader,
+// which keeps its timing between Write calls.
+func IMadmonDeterministicRateLimitWriterFactory(writer io.WriteCloser, bufferSize, limit int) io.WriteCloser {
+	pending := bytes.NewReader(nil)
+	return &IMadmonRateLimitedWriter{
+		writer:  writer,
+		pending: pending,
+		reader:  limitedreader.NewLimitedReader(pending, int64(limit)),
+		buffer:  make([]byte, bufferSize),
+	}
+}
+
+type IMadmonRateLimitedWriter struct {
+	writer  io.WriteCloser
+	pending *bytes.Reader // the bytes of the current Write not read through the limiter yet
+	reader  *limitedreader.LimitedReader
+	buffer  []byte
+}
+
+func (w *IMadmonRateLimitedWriter) Write(p []byte) (n int, err error) {
+	w.pending.Reset(p)
+	// stop before the pending bytes run out, the limited reader never sees an EOF
+	for w.pending.Len() > 0 {
+		read, err := w.reader.Read(w.buffer)
+		written, writeErr := w.writer.Write(w.buffer[:read])
+		n += written
+		if writeErr != nil {
+			return n, writeErr
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (w *IMadmonRateLimitedWriter) Close() error {
+	return w.writer.Close()
+}
+
+// writeChunks writes p in chunks of chunkSize, waiting before each one.
+func writeChunks(writer io.Writer, p []byte, chunkSize int, wait func() error) (n int, err error) {
+	for n < len(p) {
+		if err = wait(); err != nil {
+			return n, err
+		}
+		written, err := writer.Write(p[n:min(len(p), n+chunkSize)])
+		n += written
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// bufferWriteCloser collects the written bytes, recording whether it was closed.
+type bufferWriteCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *bufferWriteCloser) Close() error {
+	w.closed = true
+	return nil
+}
+
+// writeAll writes data in bufferSize Write calls.
+func writeAll(writer io.Writer, data []byte, bufferSize int) error {
+	for len(data) > 0 {
+		n, err := writer.Write(data[:min(len(data), bufferSize)])
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func TestWritersDeliverAllBytes(t *testing.T) {
+	const dataSize = 4*testBufferSize + 123 // the last Write is partial
+
+	for _, writer := range RegisteredWriters() {
+		t.Run(string(writer.Type), func(t *testing.T) {
+			destination := &bufferWriteCloser{}
+			limitedWriter := writer.Factory(destination, testBufferSize, overheadLimit)
+			if err := writeAll(limitedWriter, testPattern(dataSize), testBufferSize); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if !bytes.Equal(destination.Bytes(), testPattern(dataSize)) {
+				t.Fatalf("wrote %d bytes differing from the %d given bytes", destination.Len(), dataSize)
+			}
+
+			if err := limitedWriter.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if !destination.closed {
+				t.Fatalf("Close did not reach the destination")
+			}
+		})
+	}
+}
+
+func TestWritersHonorLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes for seconds")
+	}
+	limits := []struct {
+		limit    int
+		dataSize int
+	}{
+		{testLimit, 2 * testLimit},
+		{1024, 2 * 1024}, // below a buffer per second
+	}
+
+	for _, writer := range RegisteredWriters() {
+		for _, limit := range limits {
+			t.Run(fmt.Sprintf("%s/Limit%d", writer.Type, limit.limit), func(t *testing.T) {
+				t.Parallel()
+				limitedWriter := writer.Factory(&bufferWriteCloser{}, testBufferSize, limit.limit)
+
+				start := time.Now()
+				if err := writeAll(limitedWriter, testPattern(limit.dataSize), testBufferSize); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+				elapsed := time.Since(start)
+				checkRate(t, limit.dataSize, limit.limit, elapsed)
+			})
+		}
+	}
+}